@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 每个数据报在线路上的额外开销估计（假设每个QUIC包只承载一个帧，IPv4）
+const (
+	ipv4HeaderLen       = 20
+	udpHeaderLen        = 8
+	quicShortHeaderLen  = 1 + 4 + 4 // 标志字节 + 连接ID (quic-go默认4字节) + 包序号（最多4字节）
+	quicAEADTagLen      = 16
+	datagramFrameHeader = 1 + 2         // 帧类型 + 长度varint
+	streamFrameHeader   = 1 + 1 + 4 + 2 // 帧类型 + 流ID + 偏移 + 长度varint
+	dtlsRecordOverhead  = 13 + 8 + 16   // DTLS 1.2记录头 + 显式nonce + AES-GCM标签
+	sctpDataOverhead    = 12 + 16       // SCTP公共头 + DATA块头
+
+	// quicPacketOverhead 单个QUIC短包头包在帧之外的开销
+	quicPacketOverhead = ipv4HeaderLen + udpHeaderLen + quicShortHeaderLen + quicAEADTagLen
+	// datagramWireOverhead 单个QUIC数据报的协议开销（字节）
+	datagramWireOverhead = quicPacketOverhead + datagramFrameHeader
+)
+
+// wireOverhead 返回 mode 下单个测试数据报的协议开销估计（字节）。
+// 流模式的多条消息可能合并进同一个QUIC包，按每条消息一个包估计的是上限
+func wireOverhead(mode string) int {
+	switch mode {
+	case "udp":
+		return ipv4HeaderLen + udpHeaderLen
+	case "stream":
+		return quicPacketOverhead + streamFrameHeader + 2 // 2字节消息长度前缀
+	case "webtransport":
+		return datagramWireOverhead + webTransportDatagramPrefix
+	case "h3", "masque":
+		// masque模式只计客户端到代理一段
+		return datagramWireOverhead + httpDatagramPrefix
+	case "libp2p-webrtc":
+		return ipv4HeaderLen + udpHeaderLen + dtlsRecordOverhead + sctpDataOverhead
+	default:
+		return datagramWireOverhead
+	}
+}
+
+// ParseBitrate 解析带单位的比特率，例如 "50M"、"1.5G"、"800k"、"2Mbps"，返回 bit/s
+func ParseBitrate(s string) (float64, error) {
+	str := strings.TrimSpace(s)
+	lower := strings.ToLower(str)
+	for _, suffix := range []string{"bit/s", "bps", "bit"} {
+		if strings.HasSuffix(lower, suffix) {
+			str = str[:len(str)-len(suffix)]
+			break
+		}
+	}
+
+	multiplier := 1.0
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'k', 'K':
+			multiplier = 1e3
+		case 'm', 'M':
+			multiplier = 1e6
+		case 'g', 'G':
+			multiplier = 1e9
+		}
+		if multiplier != 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value <= 0 || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("无效的比特率: %q (示例: 50M, 800k, 1.5G)", s)
+	}
+	return value * multiplier, nil
+}
+
+// RateForBitrate 根据目标线路比特率和数据包大小计算发送速率（包/秒），计入每包 overhead 字节的协议开销
+func RateForBitrate(bitrate float64, packetSize, overhead int) int {
+	bitsPerPacket := float64(packetSize+overhead) * 8
+	rate := int(math.Round(bitrate / bitsPerPacket))
+	if rate < 1 {
+		rate = 1
+	}
+	return rate
+}
+
+// WireBytes 返回 count 个总负载为 payloadBytes、每个开销 overhead 字节的数据报在线路上的字节数估计
+func WireBytes(payloadBytes, count int64, overhead int) int64 {
+	return payloadBytes + count*int64(overhead)
+}
+
+// FormatBitrate 将 bit/s 格式化为易读的字符串
+func FormatBitrate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbit/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbit/s", bps/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.2f kbit/s", bps/1e3)
+	default:
+		return fmt.Sprintf("%.0f bit/s", bps)
+	}
+}
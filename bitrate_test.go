@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{"无单位", "1000", 1000, false},
+		{"k", "800k", 800e3, false},
+		{"大写M", "50M", 50e6, false},
+		{"小数G", "1.5G", 1.5e9, false},
+		{"bps后缀", "2Mbps", 2e6, false},
+		{"bit/s后缀", "10kbit/s", 10e3, false},
+		{"前后空白", " 5m ", 5e6, false},
+		{"空字符串", "", 0, true},
+		{"只有单位", "M", 0, true},
+		{"零", "0", 0, true},
+		{"负数", "-5M", 0, true},
+		{"无穷大", "Inf", 0, true},
+		{"非数字", "fast", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBitrate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBitrate(%q) err = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBitrate(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateForBitrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		bitrate  float64
+		size     int
+		overhead int
+		want     int
+	}{
+		{"QUIC数据报开销", 1e6, 1194, datagramWireOverhead, 100},
+		{"裸UDP开销更小", 1e6, 1222, wireOverhead("udp"), 100},
+		{"无开销", 8000, 100, 0, 10},
+		{"四舍五入", 1e6, 1000, 0, 125},
+		{"至少1包每秒", 1, 1200, datagramWireOverhead, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RateForBitrate(tt.bitrate, tt.size, tt.overhead); got != tt.want {
+				t.Errorf("RateForBitrate(%v, %d, %d) = %d, want %d", tt.bitrate, tt.size, tt.overhead, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWireOverhead(t *testing.T) {
+	tests := []struct {
+		mode string
+		want int
+	}{
+		{"native", 56},
+		{"libp2p", 56},
+		{"udp", 28},
+		{"stream", 63},
+		{"webtransport", 57},
+		{"h3", 58},
+		{"masque", 58},
+		{"libp2p-webrtc", 93},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if got := wireOverhead(tt.mode); got != tt.want {
+				t.Errorf("wireOverhead(%q) = %d, want %d", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// bulkStreamPreface 批量数据流开头的前缀，服务端据此区分批量数据流和以JSON开头的控制流
+	bulkStreamPreface = "QDBULK1\n"
+	// bulkChunkSize 批量数据流每次写入的字节数
+	bulkChunkSize = 16 * 1024
+)
+
+// InterferenceResult 数据报与流混合测试的结果：同一速率和包大小的数据报
+// 先在空闲连接上发送，再与批量数据流同时发送
+type InterferenceResult struct {
+	BulkStreams         int             `json:"bulk_streams"`
+	BulkRateBps         float64         `json:"bulk_rate_bps,omitempty"` // 每条流的目标速率，0表示尽快发送
+	Baseline            MeasurementStep `json:"baseline"`
+	Loaded              MeasurementStep `json:"loaded"`
+	StreamSentBytes     int64           `json:"stream_sent_bytes"`
+	StreamReceivedBytes int64           `json:"stream_received_bytes"`
+	StreamSendBps       float64         `json:"stream_send_bps"`
+	StreamReceiveBps    float64         `json:"stream_receive_bps"`
+}
+
+// bulkEnabled 是否运行数据报与流混合测试
+func (c *Client) bulkEnabled() bool {
+	return c.config.BulkStreams > 0
+}
+
+// writeBulkStream 写入前缀后持续写入数据，bitrate 大于0时按该速率限速，直到ctx被取消
+func writeBulkStream(ctx context.Context, stream Stream, bitrate float64, written *atomic.Int64) error {
+	if _, err := stream.Write([]byte(bulkStreamPreface)); err != nil {
+		return fmt.Errorf("写入批量数据流失败: %w", err)
+	}
+
+	// ctx取消时以写超时打断阻塞在流量控制上的写入
+	stop := context.AfterFunc(ctx, func() { stream.SetWriteDeadline(time.Now()) })
+	defer stop()
+
+	var pacer *Pacer
+	if bitrate > 0 {
+		pacer = NewPacer(bitrate / 8 / bulkChunkSize)
+	}
+
+	chunk := make([]byte, bulkChunkSize)
+	for {
+		n := 1
+		if pacer != nil {
+			var err error
+			if n, err = pacer.Wait(ctx); err != nil {
+				return nil
+			}
+		}
+		for i := 0; i < n; i++ {
+			w, err := stream.Write(chunk)
+			written.Add(int64(w))
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("写入批量数据流失败: %w", err)
+			}
+		}
+	}
+}
+
+// runBulkLoad 打开 -bulk-streams 条批量数据流并持续写入，直到ctx被取消，返回写入的总字节数
+func (c *Client) runBulkLoad(ctx context.Context, bitrate float64) (int64, error) {
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, c.config.BulkStreams)
+
+	for i := 0; i < c.config.BulkStreams; i++ {
+		stream, err := c.conn.OpenStream(ctx)
+		if err != nil {
+			errs <- fmt.Errorf("打开批量数据流失败: %w", err)
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stream.Close()
+			if err := writeBulkStream(ctx, stream, bitrate, &written); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return written.Load(), <-errs
+}
+
+// runInterference 先只发送数据报测量空闲基线，再在同一连接上同时运行批量数据流，
+// 比较两个阶段数据报的丢包、延迟和抖动。每个阶段持续 -duration。
+func (c *Client) runInterference(bitrate float64) (InterferenceResult, error) {
+	result := InterferenceResult{BulkStreams: c.config.BulkStreams, BulkRateBps: bitrate}
+	rate, size, duration := c.config.SendRate, c.config.PacketSize, c.config.Duration
+
+	fmt.Fprintf(c.out, "阶段1 空闲基线: %d pps, %d 字节, 持续 %v\n", rate, size, duration)
+	baseline, baseReport, err := c.measureStep(rate, size, duration, nil)
+	if err != nil {
+		return result, err
+	}
+	result.Baseline = baseline
+
+	bulkRate := "尽快发送"
+	if bitrate > 0 {
+		bulkRate = "每条 " + FormatBitrate(bitrate)
+	}
+	fmt.Fprintf(c.out, "阶段2 流负载: %d 条批量数据流 (%s)，同时发送数据报，持续 %v\n", c.config.BulkStreams, bulkRate, duration)
+
+	var bulkErr error
+	var bulkElapsed time.Duration
+	loaded, loadReport, err := c.measureStep(rate, size, duration, func(ctx context.Context) {
+		start := time.Now()
+		result.StreamSentBytes, bulkErr = c.runBulkLoad(ctx, bitrate)
+		bulkElapsed = time.Since(start)
+	})
+	if err != nil {
+		return result, err
+	}
+	if bulkErr != nil {
+		return result, bulkErr
+	}
+	result.Loaded = loaded
+
+	result.StreamReceivedBytes = loadReport.BulkBytes - baseReport.BulkBytes
+	if bulkElapsed > 0 {
+		result.StreamSendBps = float64(result.StreamSentBytes) * 8 / bulkElapsed.Seconds()
+		result.StreamReceiveBps = float64(result.StreamReceivedBytes) * 8 / bulkElapsed.Seconds()
+	}
+	return result, nil
+}
+
+// signedDuration 带正负号的时长，用于显示变化量
+func signedDuration(d time.Duration) string {
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+// Print 打印空闲基线和流负载下数据报表现的对比
+func (r *InterferenceResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "\n=== 数据报与流混合测试结果 ===\n")
+	fmt.Fprintf(w, "%-10s %10s %10s %12s %12s %12s %16s\n",
+		"阶段", "发送", "丢包率", "p50", "p99", "平均抖动", "数据报有效吞吐")
+	for _, phase := range []struct {
+		name string
+		step MeasurementStep
+	}{{"空闲基线", r.Baseline}, {"流负载下", r.Loaded}} {
+		fmt.Fprintf(w, "%-10s %10d %9.2f%% %12v %12v %12v %16s\n",
+			phase.name, phase.step.Sent, phase.step.LossRate*100,
+			time.Duration(phase.step.P50Ns), time.Duration(phase.step.P99Ns),
+			time.Duration(phase.step.JitterNs), FormatBitrate(phase.step.GoodputBps))
+	}
+
+	fmt.Fprintf(w, "变化: 丢包率 %+.2f 个百分点, p50 %s, p99 %s, 平均抖动 %s\n",
+		(r.Loaded.LossRate-r.Baseline.LossRate)*100,
+		signedDuration(time.Duration(r.Loaded.P50Ns-r.Baseline.P50Ns)),
+		signedDuration(time.Duration(r.Loaded.P99Ns-r.Baseline.P99Ns)),
+		signedDuration(time.Duration(r.Loaded.JitterNs-r.Baseline.JitterNs)))
+	fmt.Fprintf(w, "批量数据流: %d 条, 发送 %.2f MB (%s), 服务端接收 %.2f MB (%s)\n",
+		r.BulkStreams,
+		float64(r.StreamSentBytes)/1024/1024, FormatBitrate(r.StreamSendBps),
+		float64(r.StreamReceivedBytes)/1024/1024, FormatBitrate(r.StreamReceiveBps))
+	fmt.Fprintf(w, "==============================\n")
+}
+
+// reportInterference 输出混合测试的JSON结果文档
+func (c *Client) reportInterference(result InterferenceResult, start time.Time) {
+	if !c.reporter.Enabled() {
+		return
+	}
+
+	c.reporter.Write(ResultDocument{
+		Type:         "result",
+		Role:         "client",
+		Mode:         c.config.Mode,
+		Version:      Version,
+		StartTime:    start,
+		EndTime:      time.Now(),
+		Params:       c.config,
+		SizeProbe:    c.sizeProbe,
+		Interference: &result,
+	})
+}
+
+// bufferedStream 读取经过缓冲的流，用于在识别流类型时预读的数据不丢失
+type bufferedStream struct {
+	Stream
+	reader *bufio.Reader
+}
+
+func (s *bufferedStream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+// drainBulkStream 读取并丢弃批量数据流的内容，计入会话的流接收字节数
+func (s *Server) drainBulkStream(ctx context.Context, reader io.Reader, session *Session) {
+	active := session.bulkStreams.Add(1)
+	fmt.Fprintf(s.out, "会话 %s 批量数据流开始 (当前 %d 条)\n", session.ID, active)
+
+	start := time.Now()
+	buf := make([]byte, 64*1024)
+	var total int64
+	for {
+		n, err := reader.Read(buf)
+		total += int64(n)
+		session.bulkBytes.Add(int64(n))
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				fmt.Fprintf(s.out, "会话 %s 批量数据流错误: %v\n", session.ID, err)
+			}
+			break
+		}
+	}
+	session.bulkStreams.Add(-1)
+
+	elapsed := time.Since(start)
+	fmt.Fprintf(s.out, "会话 %s 批量数据流结束: %.2f MB, 持续 %v, 平均 %s\n",
+		session.ID, float64(total)/1024/1024, elapsed.Round(time.Millisecond),
+		FormatBitrate(float64(total)*8/elapsed.Seconds()))
+}
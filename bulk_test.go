@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteBulkStream(t *testing.T) {
+	const duration = 250 * time.Millisecond
+	tests := []struct {
+		name      string
+		bitrate   float64
+		maxChunks int64 // 0表示不限
+	}{
+		{"不限速", 0, 0},
+		// 20块/秒持续250ms约5块，加上开始时立即发送的一块和取消时未写完的一块
+		{"限速", 20 * bulkChunkSize * 8, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, reader := net.Pipe()
+			defer reader.Close()
+
+			received := make(chan []byte, 1)
+			go func() {
+				data, _ := io.ReadAll(reader)
+				received <- data
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), duration)
+			defer cancel()
+			var written atomic.Int64
+			if err := writeBulkStream(ctx, writer, tt.bitrate, &written); err != nil {
+				t.Fatalf("ctx取消后应返回nil: %v", err)
+			}
+			writer.Close()
+			data := <-received
+
+			if !bytes.HasPrefix(data, []byte(bulkStreamPreface)) {
+				t.Fatalf("流开头不是 %q", bulkStreamPreface)
+			}
+			body := int64(len(data) - len(bulkStreamPreface))
+			if body != written.Load() {
+				t.Errorf("对端收到 %d 字节, 计数 %d 字节", body, written.Load())
+			}
+			if body == 0 {
+				t.Error("没有写入任何数据")
+			}
+			if tt.maxChunks > 0 && body > tt.maxChunks*bulkChunkSize {
+				t.Errorf("%v 内写入 %d 块, want 不超过 %d 块", duration, body/bulkChunkSize, tt.maxChunks)
+			}
+		})
+	}
+}
+
+func TestSignedDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{1500 * time.Microsecond, "+1.5ms"},
+		{0, "+0s"},
+		{-2 * time.Second, "-2s"},
+	}
+	for _, tt := range tests {
+		if got := signedDuration(tt.d); got != tt.want {
+			t.Errorf("signedDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
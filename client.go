@@ -3,12 +3,19 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	tpt "github.com/libp2p/go-libp2p/core/transport"
@@ -16,20 +23,96 @@ import (
 	"github.com/quic-go/quic-go"
 )
 
+const (
+	// echoDrainTimeout 发送结束后等待迟到回显和下行数据报的时间
+	echoDrainTimeout = time.Second
+
+	// 控制数据报的重发间隔和次数
+	controlRetryInterval = 200 * time.Millisecond
+	controlRetries       = 10
+)
+
+// errControlTimeout 控制请求在重发多次后仍未收到响应
+var errControlTimeout = errors.New("控制请求超时")
+
 type ClientConfig struct {
-	Mode        string
-	ServerAddr  string
-	PeerAddr    string // libp2p模式下的multiaddr
-	PacketSize  int
-	SendRate    int
-	Duration    time.Duration
-	PayloadType string
+	Mode        string        `json:"mode"`
+	ServerAddr  string        `json:"server,omitempty"`
+	PeerAddr    string        `json:"peer,omitempty"`       // libp2p模式下的multiaddr或Peer ID
+	Rendezvous  string        `json:"rendezvous,omitempty"` // libp2p模式下通过DHT查找服务端的rendezvous命名空间
+	Proxy       string        `json:"proxy,omitempty"`      // masque模式的CONNECT-UDP代理地址，为空时启动本地代理
+	PacketSize  int           `json:"packet_size"`
+	SendRate    int           `json:"send_rate"`
+	Bitrate     string        `json:"bitrate,omitempty"` // 目标线路比特率，设置后由包大小推导 SendRate
+	Duration    time.Duration `json:"duration_ns"`
+	PayloadType string        `json:"payload_type"`
+	Echo        bool          `json:"echo"`                // 期望服务端回显数据包，用于测量往返时延
+	Checksum    bool          `json:"checksum,omitempty"`  // 在数据报头部携带CRC32C校验和
+	DownRate    int           `json:"down_rate,omitempty"` // 请求服务端下行发送的速率，0表示不启用
+	DownSize    int           `json:"down_size,omitempty"`
+	Flows       string        `json:"flows,omitempty"` // 多个并发流的定义，设置后忽略 -size 和 -rate
+
+	// 数据报与流混合测试参数
+	BulkStreams int    `json:"bulk_streams,omitempty"`
+	BulkRate    string `json:"bulk_rate,omitempty"` // 每条批量数据流的目标比特率，为空时尽快发送
+
+	// 多连接测试参数
+	Connections int           `json:"connections,omitempty"`
+	Stagger     time.Duration `json:"stagger_ns,omitempty"` // 相邻两个连接开始建立的间隔
+
+	// libp2p模式下通过mDNS在局域网内查找服务端
+	Discover     bool          `json:"discover,omitempty"`
+	DiscoverWait time.Duration `json:"discover_wait_ns,omitempty"`
+	DiscoverList bool          `json:"-"` // 只列出发现的服务端，不进行测试
+
+	// 传输方式对照测试参数
+	Compare   string `json:"compare,omitempty"`    // 依次测试的传输方式，例如 "udp,native,stream"
+	UDPServer string `json:"udp_server,omitempty"` // 对照测试中裸UDP服务端的地址
+
+	// 尺寸探测参数
+	ProbeSize bool `json:"probe_size"`
+	ClampSize bool `json:"clamp_size"`
+
+	// 分步测试（饱和测试和矩阵测试）每一步的发送时间和等待时间
+	StepDuration time.Duration `json:"step_duration_ns,omitempty"`
+	Settle       time.Duration `json:"settle_ns,omitempty"`
+
+	// 饱和测试参数
+	Saturate           bool          `json:"saturate,omitempty"`
+	MaxLoss            float64       `json:"max_loss,omitempty"` // 百分比
+	MaxLatencyGrowth   time.Duration `json:"max_latency_growth_ns,omitempty"`
+	MaxRate            int           `json:"max_rate,omitempty"`
+	SaturateIterations int           `json:"saturate_iterations,omitempty"`
+
+	// 矩阵测试参数
+	Sizes   string `json:"sizes,omitempty"` // 包大小列表或范围，如 "64,256,1024" 或 "200-1200:200"
+	Rates   string `json:"rates,omitempty"`
+	CSVFile string `json:"csv_file,omitempty"`
+
+	Output     string `json:"-"`
+	OutputFile string `json:"-"`
+	Verbose    bool   `json:"-"` // 逐包输出收到的下行数据报
 }
 
 type Client struct {
-	conn   Connection
-	config ClientConfig
-	stats  ClientStats
+	conn     Connection
+	config   ClientConfig
+	stats    ClientStats
+	reporter *Reporter
+	out      io.Writer // 文本信息的输出目标
+
+	downStats ServerStats // 下行数据报的接收统计
+	sizeProbe *SizeProbeResult
+	control   *ControlStream // 与服务端协商测试的控制流，服务端不支持时为nil
+	flows     []*clientFlow  // 多流测试的各个流，单流测试时为空
+	quiet     bool           // 多连接测试中只输出汇总
+	setupTime time.Duration  // 建立连接（含握手）的耗时
+
+	// 控制请求的等待者，按请求ID索引
+	controlMutex   sync.Mutex
+	controlSeq     uint64
+	controlWaiters map[uint64]chan []byte
+	resetEpoch     uint64
 }
 
 func (c *Client) connectNative() error {
@@ -38,56 +121,65 @@ func (c *Client) connectNative() error {
 		NextProtos:         []string{"quic-datagram-test"},
 	}
 
+	dialStart := time.Now()
 	conn, err := quic.DialAddr(context.Background(), c.config.ServerAddr, tlsConfig, &quic.Config{
 		EnableDatagrams: true,
 	})
 	if err != nil {
 		return err
 	}
+	c.setupTime = time.Since(dialStart)
 
 	c.conn = &NativeConnection{conn: conn}
 	c.stats.StartTime = time.Now()
 	return nil
 }
 
-func (c *Client) connectLibP2P(config *Config) error {
-	transport, err := makeDatagramTransport(config)
+func (c *Client) connectLibP2P(config *Config) (err error) {
+	transport, err := makeDatagramTransport(c.config.Mode, config)
 	if err != nil {
 		return fmt.Errorf("创建transport失败: %w", err)
 	}
 
+	// webrtc-direct的客户端只拨号，不需要监听
+	listenAddrs := libp2p.ListenAddrStrings("/ip4/0.0.0.0/udp/0/quic-v1")
+	if c.config.Mode == "libp2p-webrtc" {
+		listenAddrs = libp2p.NoListenAddrs
+	}
+
 	h, err := libp2p.New(
 		libp2p.Identity(config.PrivateKey),
 		libp2p.Transport(func() (tpt.Transport, error) { return transport, nil }),
-		libp2p.ListenAddrStrings("/ip4/0.0.0.0/udp/0/quic-v1"),
+		listenAddrs,
 		libp2p.DisableRelay(),
 	)
 	if err != nil {
 		return fmt.Errorf("创建libp2p host失败: %w", err)
 	}
+	// 连接建立后由 LibP2PConnection.Close 关闭host
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
 
-	fmt.Printf("本地 Peer ID: %s\n", h.ID())
-
-	// 解析目标地址
-	targetAddr, err := ma.NewMultiaddr(c.config.PeerAddr)
-	if err != nil {
-		return fmt.Errorf("解析目标地址失败: %w", err)
-	}
+	c.logf("本地 Peer ID: %s\n", h.ID())
 
-	// 提取peer ID
-	addrInfo, err := peer.AddrInfoFromP2pAddr(targetAddr)
+	addrInfo, err := c.resolvePeer(h, config)
 	if err != nil {
-		return fmt.Errorf("提取peer信息失败: %w", err)
+		return err
 	}
 
 	// 添加到peerstore
 	h.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.PermanentAddrTTL)
 
 	// 连接到对等节点
-	fmt.Printf("正在连接到: %s\n", addrInfo.ID)
+	c.logf("正在连接到: %s\n", addrInfo.ID)
+	dialStart := time.Now()
 	if err := h.Connect(context.Background(), *addrInfo); err != nil {
 		return fmt.Errorf("连接失败: %w", err)
 	}
+	c.setupTime = time.Since(dialStart)
 
 	// 等待连接建立
 	time.Sleep(500 * time.Millisecond)
@@ -98,100 +190,898 @@ func (c *Client) connectLibP2P(config *Config) error {
 		return fmt.Errorf("未找到到目标节点的连接")
 	}
 
-	libp2pConn, err := NewLibP2PConnection(conns[0])
+	libp2pConn, err := NewLibP2PConnection(h, conns[0])
 	if err != nil {
 		return fmt.Errorf("创建LibP2P连接失败: %w", err)
 	}
 
+	libp2pConn.ownsHost = true
 	c.conn = libp2pConn
 	c.stats.StartTime = time.Now()
 	return nil
 }
 
-func (c *Client) sendPackets() {
-	ctx := context.Background()
-	interval := time.Second / time.Duration(c.config.SendRate)
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// resolvePeer 确定要连接的节点：-peer 为完整multiaddr时直接解析；使用 -discover 时通过mDNS查找；
+// 只给出Peer ID或使用 -rendezvous 时先连接bootstrap节点，通过DHT查找
+func (c *Client) resolvePeer(h host.Host, config *Config) (*peer.AddrInfo, error) {
+	if strings.HasPrefix(c.config.PeerAddr, "/") {
+		// 解析目标地址
+		targetAddr, err := ma.NewMultiaddr(c.config.PeerAddr)
+		if err != nil {
+			return nil, fmt.Errorf("解析目标地址失败: %w", err)
+		}
+
+		// 提取peer ID
+		addrInfo, err := peer.AddrInfoFromP2pAddr(targetAddr)
+		if err != nil {
+			return nil, fmt.Errorf("提取peer信息失败: %w", err)
+		}
+		return addrInfo, nil
+	}
+
+	if c.config.Discover {
+		return c.discoverPeer(h.ID())
+	}
+
+	if len(config.BootstrapNodes) == 0 {
+		return nil, fmt.Errorf("通过DHT查找节点需要在 %s 中配置bootstrap节点", filepath.Join(config.ConfigDir, bootstrapFileName))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dhtLookupTimeout)
+	defer cancel()
+	kad, err := newDHT(ctx, h, false)
+	if err != nil {
+		return nil, fmt.Errorf("启动DHT失败: %w", err)
+	}
+	// 找到的节点由host直接连接，之后不再需要DHT
+	defer kad.Close()
+	n := joinDHT(ctx, kad, config.BootstrapNodes, c.out)
+	if n == 0 {
+		return nil, fmt.Errorf("无法连接任何bootstrap节点")
+	}
+	c.logf("已连接 %d/%d 个bootstrap节点\n", n, len(config.BootstrapNodes))
+
+	if c.config.PeerAddr != "" {
+		id, err := peer.Decode(c.config.PeerAddr)
+		if err != nil {
+			return nil, fmt.Errorf("-peer 既不是multiaddr也不是有效的Peer ID: %w", err)
+		}
+		c.logf("正在通过DHT查找节点: %s\n", id)
+		info, err := kad.FindPeer(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("DHT中未找到节点 %s: %w", id, err)
+		}
+		return &info, nil
+	}
+
+	c.logf("正在通过DHT查找rendezvous命名空间 %q 下的服务端\n", c.config.Rendezvous)
+	providers, err := findProviders(ctx, kad, c.config.Rendezvous)
+	if err != nil {
+		return nil, fmt.Errorf("查找rendezvous命名空间失败: %w", err)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("rendezvous命名空间 %q 下没有找到服务端", c.config.Rendezvous)
+	}
+	c.logf("找到 %d 个服务端，连接 %s\n", len(providers), providers[0].ID)
+	return &providers[0], nil
+}
+
+// discoverPeer 通过mDNS在局域网内查找服务端：-peer 给出Peer ID时等待该节点，否则连接最先应答的服务端。
+// 跳过与本节点 self 相同的Peer ID，不会拨号到自身
+func (c *Client) discoverPeer(self peer.ID) (*peer.AddrInfo, error) {
+	var want peer.ID
+	if c.config.PeerAddr != "" {
+		id, err := peer.Decode(c.config.PeerAddr)
+		if err != nil {
+			return nil, fmt.Errorf("-peer 既不是multiaddr也不是有效的Peer ID: %w", err)
+		}
+		want = id
+		c.logf("正在通过mDNS查找节点: %s\n", want)
+	} else {
+		c.logf("正在通过mDNS查找局域网内的服务端\n")
+	}
+
+	var target *peer.AddrInfo
+	_, err := discoverServers(c.config.DiscoverWait, func(info peer.AddrInfo) bool {
+		if info.ID == self || (want != "" && info.ID != want) {
+			return false
+		}
+		target = &info
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		if want != "" {
+			return nil, fmt.Errorf("%v 内没有通过mDNS找到节点 %s", c.config.DiscoverWait, want)
+		}
+		return nil, fmt.Errorf("%v 内没有通过mDNS找到服务端", c.config.DiscoverWait)
+	}
+	c.logf("通过mDNS找到服务端: %s\n", target.ID)
+	return target, nil
+}
+
+func newClient(config ClientConfig, reporter *Reporter, flows []FlowSpec) *Client {
+	client := &Client{config: config, reporter: reporter, out: reporter.Text(), controlWaiters: make(map[uint64]chan []byte)}
+	overhead := wireOverhead(config.Mode)
+	client.stats.overhead = overhead
+	client.downStats.overhead = overhead
+	for _, spec := range flows {
+		flow := &clientFlow{Spec: spec}
+		flow.Stats.overhead = overhead
+		client.flows = append(client.flows, flow)
+	}
+	return client
+}
+
+func (c *Client) connectStream() error {
+	dialStart := time.Now()
+	conn, err := dialStreamConnection(context.Background(), c.config.ServerAddr)
+	if err != nil {
+		return err
+	}
+	c.setupTime = time.Since(dialStart)
+
+	c.conn = conn
+	c.stats.StartTime = time.Now()
+	return nil
+}
+
+func (c *Client) connectWebTransport() error {
+	dialStart := time.Now()
+	conn, err := dialWebTransport(context.Background(), c.config.ServerAddr)
+	if err != nil {
+		return err
+	}
+	c.setupTime = time.Since(dialStart)
+
+	c.conn = conn
+	c.stats.StartTime = time.Now()
+	return nil
+}
+
+func (c *Client) connectHTTPDatagram() error {
+	// 未指定代理时在本进程启动一个只监听回环地址的代理，连接关闭时随之停止
+	proxy := c.config.Proxy
+	var stopProxy func()
+	if c.config.Mode == "masque" && proxy == "" {
+		var err error
+		if proxy, stopProxy, err = startMasqueProxy("127.0.0.1:0", c.out); err != nil {
+			return fmt.Errorf("启动本地CONNECT-UDP代理失败: %w", err)
+		}
+		c.logf("已启动本地CONNECT-UDP代理: %s\n", proxy)
+	}
+
+	dialStart := time.Now()
+	var conn *HTTPDatagramConnection
+	var err error
+	if c.config.Mode == "masque" {
+		conn, err = dialMasque(context.Background(), proxy, c.config.ServerAddr)
+	} else {
+		conn, err = dialHTTPDatagram(context.Background(), c.config.ServerAddr, h3DatagramPath)
+	}
+	if err != nil {
+		if stopProxy != nil {
+			stopProxy()
+		}
+		return err
+	}
+	conn.onClose = stopProxy
+	c.setupTime = time.Since(dialStart)
+
+	c.conn = conn
+	c.stats.StartTime = time.Now()
+	return nil
+}
+
+func (c *Client) connectUDP() error {
+	conn, err := dialUDP(c.config.ServerAddr)
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.stats.StartTime = time.Now()
+	return nil
+}
+
+// connect 按模式建立连接，libp2p模式使用 p2pConfig 中的身份
+func (c *Client) connect(p2pConfig *Config) error {
+	switch c.config.Mode {
+	case "libp2p", "libp2p-webrtc":
+		if c.config.PeerAddr == "" && c.config.Discover {
+			c.logf("使用LibP2P模式连接到局域网内通过mDNS发现的服务端\n")
+		} else if c.config.PeerAddr == "" {
+			c.logf("使用LibP2P模式连接到rendezvous命名空间 %q 下的服务端\n", c.config.Rendezvous)
+		} else {
+			c.logf("使用LibP2P模式连接到: %s\n", c.config.PeerAddr)
+		}
+		return c.connectLibP2P(p2pConfig)
+	case "stream":
+		c.logf("使用Stream模式连接到服务器: %s\n", c.config.ServerAddr)
+		return c.connectStream()
+	case "webtransport":
+		c.logf("使用WebTransport模式连接到服务器: https://%s%s\n", c.config.ServerAddr, webTransportPath)
+		return c.connectWebTransport()
+	case "h3":
+		c.logf("使用HTTP/3数据报模式连接到服务器: https://%s%s\n", c.config.ServerAddr, h3DatagramPath)
+		return c.connectHTTPDatagram()
+	case "masque":
+		c.logf("使用MASQUE模式经CONNECT-UDP代理连接到UDP服务器: %s\n", c.config.ServerAddr)
+		return c.connectHTTPDatagram()
+	case "udp":
+		c.logf("使用裸UDP模式连接到服务器: %s\n", c.config.ServerAddr)
+		return c.connectUDP()
+	}
+	c.logf("使用Native模式连接到服务器: %s\n", c.config.ServerAddr)
+	return c.connectNative()
+}
+
+// logf 输出单个连接的过程信息，多连接测试中省略
+func (c *Client) logf(format string, args ...any) {
+	if !c.quiet {
+		fmt.Fprintf(c.out, format, args...)
+	}
+}
+
+// startReceive 启动接收协程，返回的函数停止接收并等待协程退出
+func (c *Client) startReceive() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.receiveLoop(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// prepare 探测可用的最大数据报负载，再按最终的包大小换算比特率
+func (c *Client) prepare(bitrate float64) error {
+	if c.config.ProbeSize {
+		if err := c.checkPacketSize(); err != nil {
+			return err
+		}
+	}
+
+	if bitrate > 0 {
+		overhead := wireOverhead(c.config.Mode)
+		c.config.SendRate = RateForBitrate(bitrate, c.config.PacketSize, overhead)
+		c.logf("目标比特率 %s，包大小 %d 字节 (每包开销约 %d 字节)，发送速率: %d pps\n",
+			FormatBitrate(bitrate), c.config.PacketSize, overhead, c.config.SendRate)
+	}
+	return nil
+}
+
+// runTest 运行一次定时测试：通过控制流声明参数并标记起止，发送结束后等待迟到的数据报。
+// 返回服务端的最终统计，控制流不可用或获取失败时为nil。
+// 没有可靠流的连接（裸UDP）改用控制数据报重置和取回服务端统计。
+func (c *Client) runTest() (*ServerSnapshot, []FlowSnapshot, error) {
+	datagramControl := false
+	if err := c.openControlStream(); errors.Is(err, errStreamsUnsupported) {
+		if err := c.resetServerStats(); err != nil {
+			return nil, nil, err
+		}
+		datagramControl = true
+	} else if err != nil {
+		// 旧版本服务端不支持控制流时照常测试
+		fmt.Fprintf(c.out, "控制流不可用，将无法获得服务端的最终统计: %v\n", err)
+	}
+
+	if c.downlinkEnabled() {
+		if err := c.requestDownlink(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if c.control != nil {
+		if err := c.startTest(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	intervalCtx, cancelIntervals := context.WithCancel(context.Background())
+	go c.reportIntervals(intervalCtx)
+
+	if c.flowsEnabled() {
+		c.sendFlows()
+	} else {
+		c.sendPackets()
+	}
+
+	// 等待一小段时间确保最后的包被发送
+	time.Sleep(100 * time.Millisecond)
+
+	// 等待迟到的回显和下行数据报
+	if c.config.Echo || c.downlinkEnabled() {
+		time.Sleep(echoDrainTimeout)
+	}
+	cancelIntervals()
+
+	if datagramControl {
+		report, err := c.fetchServerReport()
+		if err != nil {
+			fmt.Fprintf(c.out, "获取服务端测试结果失败: %v\n", err)
+			return nil, nil, nil
+		}
+		return &report.Stats, nil, nil
+	}
+	if c.control == nil {
+		return nil, nil, nil
+	}
+	defer c.control.Close()
 
-	var seqNum uint64 = 1
-	endTime := time.Now().Add(c.config.Duration)
+	server, flows, err := c.stopTest()
+	if err != nil {
+		fmt.Fprintf(c.out, "获取服务端测试结果失败: %v\n", err)
+		return nil, nil, nil
+	}
+	return server, flows, nil
+}
 
-	fmt.Printf("开始发送数据包，发送速率: %d pps，包大小: %d 字节，持续时间: %v\n",
+func (c *Client) sendPackets() {
+	c.logf("开始发送数据包，发送速率: %d pps，包大小: %d 字节，持续时间: %v\n",
 		c.config.SendRate, c.config.PacketSize, c.config.Duration)
 
-	for time.Now().Before(endTime) {
+	runSender(context.Background(), c.conn, SendSpec{
+		Rate:        c.config.SendRate,
+		Size:        c.config.PacketSize,
+		Duration:    c.config.Duration,
+		PayloadType: c.config.PayloadType,
+		Flags:       c.headerFlags(),
+		TrackEcho:   c.config.Echo,
+		Progress:    !c.quiet,
+		Out:         c.out,
+	}, &c.stats)
+}
+
+// headerFlags 客户端发送的测试数据报的头部标志位
+func (c *Client) headerFlags() byte {
+	if c.config.Checksum {
+		return FlagChecksum
+	}
+	return 0
+}
+
+// downlinkEnabled 返回是否请求服务端发送下行数据报
+func (c *Client) downlinkEnabled() bool {
+	return c.config.DownRate > 0
+}
+
+// receiveLoop 接收服务端发来的数据报（回显、下行测试包和控制消息），直到ctx被取消
+func (c *Client) receiveLoop(ctx context.Context) {
+	for {
+		data, err := c.conn.ReceiveDatagram(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(c.out, "接收数据报错误: %v\n", err)
+			}
+			return
+		}
+
+		switch {
+		case IsControl(data):
+			c.handleControl(data)
+		case hasFlag(data, FlagDownlink):
+			c.downStats.ProcessPacket(data, c.out, c.config.Verbose)
+		default:
+			c.echoStats(data).ProcessEcho(data, c.out)
+		}
+	}
+}
+
+// handleControl 处理服务端发来的控制响应，按请求ID交给等待中的请求
+func (c *Client) handleControl(data []byte) {
+	_, body, err := DecodeControl(data)
+	if err != nil {
+		fmt.Fprintf(c.out, "解析控制消息失败: %v\n", err)
+		return
+	}
+
+	var header ControlHeader
+	if err := json.Unmarshal(body, &header); err != nil {
+		fmt.Fprintf(c.out, "解析控制消息失败: %v\n", err)
+		return
+	}
+
+	c.controlMutex.Lock()
+	waiter := c.controlWaiters[header.ID]
+	c.controlMutex.Unlock()
+
+	// 重发产生的重复响应或已超时请求的响应直接丢弃
+	if waiter != nil {
 		select {
-		case <-ticker.C:
-			payload := GeneratePayload(seqNum, c.config.PacketSize, c.config.PayloadType)
+		case waiter <- data:
+		default:
+		}
+	}
+}
 
-			err := c.conn.SendDatagram(payload)
-			if err != nil {
-				c.stats.IncrementError()
-				fmt.Printf("发送包 #%d 失败: %v\n", seqNum, err)
-			} else {
-				c.stats.IncrementSent()
+// controlRequest 发送控制请求并等待响应。控制数据报可能丢失，因此重发直到收到匹配的响应。
+// 返回响应的消息体。
+func (c *Client) controlRequest(reqType ControlType, msg ControlMessage, respType ControlType) ([]byte, error) {
+	return c.controlRequestRetries(reqType, msg, respType, controlRetries)
+}
 
-				if seqNum%100 == 0 {
-					fmt.Printf("已发送 %d 个包\n", seqNum)
-				}
+// controlRequestRetries 与 controlRequest 相同，但指定最大尝试次数
+func (c *Client) controlRequestRetries(reqType ControlType, msg ControlMessage, respType ControlType, retries int) ([]byte, error) {
+	c.controlMutex.Lock()
+	c.controlSeq++
+	id := c.controlSeq
+	waiter := make(chan []byte, 1)
+	c.controlWaiters[id] = waiter
+	c.controlMutex.Unlock()
+
+	defer func() {
+		c.controlMutex.Lock()
+		delete(c.controlWaiters, id)
+		c.controlMutex.Unlock()
+	}()
+
+	msg.SetID(id)
+	data, err := EncodeControl(reqType, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; attempt <= retries; attempt++ {
+		if err := c.conn.SendDatagram(data); err != nil {
+			return nil, fmt.Errorf("发送控制请求 %v 失败: %w", reqType, err)
+		}
+
+		select {
+		case resp := <-waiter:
+			msgType, body, err := DecodeControl(resp)
+			if err != nil {
+				return nil, err
 			}
+			if msgType != respType {
+				return nil, fmt.Errorf("控制请求 %v 收到意外的响应 %v", reqType, msgType)
+			}
+			return body, nil
+		case <-time.After(controlRetryInterval):
+		}
+	}
+	return nil, fmt.Errorf("%w: %d 次尝试后仍未收到 %v 的响应", errControlTimeout, retries, reqType)
+}
+
+// requestDownlink 请求服务端开始下行发送
+func (c *Client) requestDownlink() error {
+	req := &DownlinkRequest{
+		Rate:        c.config.DownRate,
+		Size:        c.config.DownSize,
+		Duration:    c.config.Duration,
+		PayloadType: c.config.PayloadType,
+		Checksum:    c.config.Checksum,
+	}
+	if _, err := c.controlRequest(ControlDownlinkRequest, req, ControlDownlinkAck); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "服务端已开始下行发送: %d pps，包大小: %d 字节\n", req.Rate, req.Size)
+	return nil
+}
+
+// resetServerStats 请求服务端重置本会话的接收统计
+func (c *Client) resetServerStats() error {
+	c.controlMutex.Lock()
+	c.resetEpoch++
+	epoch := c.resetEpoch
+	c.controlMutex.Unlock()
+
+	_, err := c.controlRequest(ControlStatsReset, &StatsResetRequest{Epoch: epoch}, ControlStatsResetAck)
+	return err
+}
+
+// fetchServerReport 获取服务端本会话当前的接收统计
+func (c *Client) fetchServerReport() (StatsReport, error) {
+	body, err := c.controlRequest(ControlStatsRequest, &ControlHeader{}, ControlStatsReport)
+	if err != nil {
+		return StatsReport{}, err
+	}
+
+	var report StatsReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return StatsReport{}, fmt.Errorf("解析服务端统计失败: %w", err)
+	}
+	return report, nil
+}
+
+// openControlStream 打开控制流并向服务端声明测试参数
+func (c *Client) openControlStream() error {
+	ctx, cancel := context.WithTimeout(context.Background(), controlStreamTimeout)
+	defer cancel()
+
+	stream, err := c.conn.OpenStream(ctx)
+	if err != nil {
+		return fmt.Errorf("打开控制流失败: %w", err)
+	}
+	control := NewControlStream(stream)
+
+	params := &TestParams{
+		Mode:        c.config.Mode,
+		PacketSize:  c.config.PacketSize,
+		SendRate:    c.config.SendRate,
+		Duration:    c.config.Duration,
+		PayloadType: c.config.PayloadType,
+		Echo:        c.config.Echo,
+	}
+	if c.downlinkEnabled() {
+		params.DownRate = c.config.DownRate
+		params.DownSize = c.config.DownSize
+	}
+	for _, flow := range c.flows {
+		params.Flows = append(params.Flows, flow.Spec)
+	}
+	if _, err := control.Request(StreamMessage{Type: StreamParams, Params: params}, StreamReady); err != nil {
+		control.Close()
+		return err
+	}
+
+	c.control = control
+	return nil
+}
+
+// startTest 通知服务端测试开始，服务端从此刻重新统计本会话
+func (c *Client) startTest() error {
+	_, err := c.control.Request(StreamMessage{Type: StreamStart}, StreamStarted)
+	return err
+}
 
-			seqNum++
+// stopTest 通知服务端测试结束，返回服务端本次测试的最终接收统计，多流测试时还返回各流的统计
+func (c *Client) stopTest() (*ServerSnapshot, []FlowSnapshot, error) {
+	msg := StreamMessage{Type: StreamStop, Sent: c.snapshot().Sent}
+	if c.flowsEnabled() {
+		msg.FlowSent = c.flowSent()
+	}
+	resp, err := c.control.Request(msg, StreamResult)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Stats == nil {
+		return nil, nil, fmt.Errorf("服务端的测试结果缺少统计")
+	}
+	return resp.Stats, resp.Flows, nil
+}
+
+// reportIntervals 周期性输出客户端统计快照，直到ctx被取消
+func (c *Client) reportIntervals(ctx context.Context) {
+	if !c.reporter.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			snap := c.snapshot()
+			c.reporter.Write(IntervalRecord{Type: "interval", Role: "client", Mode: c.config.Mode, Time: now, Client: &snap, Downlink: c.downlinkSnapshot()})
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// reportResult 输出最终的JSON结果文档
+func (c *Client) reportResult(server *ServerSnapshot, flows []FlowSnapshot) {
+	if !c.reporter.Enabled() {
+		return
+	}
+
+	snap := c.snapshot()
+	c.reporter.Write(ResultDocument{
+		Type:        "result",
+		Role:        "client",
+		Mode:        c.config.Mode,
+		Version:     Version,
+		StartTime:   c.stats.StartTime,
+		EndTime:     c.stats.StartTime.Add(time.Duration(snap.ElapsedNs)),
+		Params:      c.config,
+		Client:      &snap,
+		Server:      server,
+		Flows:       flows,
+		ClientFlows: c.flowSnapshots(),
+		Downlink:    c.downlinkSnapshot(),
+		SizeProbe:   c.sizeProbe,
+	})
+}
+
+// reportSaturation 输出饱和测试的JSON结果文档
+func (c *Client) reportSaturation(result SaturationResult, start time.Time) {
+	if !c.reporter.Enabled() {
+		return
+	}
+
+	c.reporter.Write(ResultDocument{
+		Type:       "result",
+		Role:       "client",
+		Mode:       c.config.Mode,
+		Version:    Version,
+		StartTime:  start,
+		EndTime:    time.Now(),
+		Params:     c.config,
+		SizeProbe:  c.sizeProbe,
+		Saturation: &result,
+	})
+}
+
+// reportSweep 输出矩阵测试的JSON结果文档
+func (c *Client) reportSweep(steps []MeasurementStep, start time.Time) {
+	if !c.reporter.Enabled() {
+		return
+	}
+
+	c.reporter.Write(ResultDocument{
+		Type:      "result",
+		Role:      "client",
+		Mode:      c.config.Mode,
+		Version:   Version,
+		StartTime: start,
+		EndTime:   time.Now(),
+		Params:    c.config,
+		SizeProbe: c.sizeProbe,
+		Sweep:     steps,
+	})
+}
+
+func (c *Client) downlinkSnapshot() *ServerSnapshot {
+	if !c.downlinkEnabled() {
+		return nil
+	}
+	snap := c.downStats.Snapshot()
+	return &snap
+}
+
 func runClient() {
 	var config ClientConfig
 
-	flag.StringVar(&config.Mode, "mode", "native", "连接模式: native 或 libp2p")
-	flag.StringVar(&config.ServerAddr, "server", "localhost:4363", "服务器地址 (native模式)")
-	flag.StringVar(&config.PeerAddr, "peer", "", "对等节点multiaddr (libp2p模式)")
+	flag.StringVar(&config.Mode, "mode", "native", "连接模式: native、stream、webtransport、h3、udp、masque、libp2p 或 libp2p-webrtc")
+	flag.StringVar(&config.ServerAddr, "server", "localhost:4363", "服务器地址 (native、stream、webtransport、h3和udp模式；masque模式为目标UDP服务器)")
+	flag.StringVar(&config.Proxy, "proxy", "", "masque模式的CONNECT-UDP代理地址，为空时在本进程启动本地代理")
+	flag.StringVar(&config.PeerAddr, "peer", "", "对等节点multiaddr，或只给出Peer ID通过DHT查找 (libp2p和libp2p-webrtc模式)")
+	flag.StringVar(&config.Rendezvous, "rendezvous", "", "通过DHT查找在该rendezvous命名空间下登记的服务端，代替 -peer (libp2p和libp2p-webrtc模式)")
+	flag.BoolVar(&config.Discover, "discover", false, "通过mDNS在局域网内查找服务端并自动连接，-peer 只给出Peer ID时连接该节点 (libp2p模式)")
+	flag.DurationVar(&config.DiscoverWait, "discover-wait", defaultDiscoverWait, "等待mDNS应答的时间")
+	flag.BoolVar(&config.DiscoverList, "discover-list", false, "只列出 -discover-wait 内通过mDNS发现的服务端，不进行测试 (libp2p模式)")
 	flag.IntVar(&config.PacketSize, "size", 1024, "数据包大小（字节）")
 	flag.IntVar(&config.SendRate, "rate", 100, "发送速率（包/秒）")
+	flag.StringVar(&config.Bitrate, "bitrate", "", "目标线路比特率，例如 50M，设置后忽略 -rate")
 	flag.DurationVar(&config.Duration, "duration", 30*time.Second, "发送持续时间")
 	flag.StringVar(&config.PayloadType, "payload", "random", "负载类型 (random/sequential)")
+	flag.BoolVar(&config.Echo, "echo", false, "接收服务端回显并统计往返时延 (服务端需使用 -echo)")
+	flag.BoolVar(&config.Checksum, "checksum", false, "在数据报头部携带CRC32C校验和，接收端校验失败时计为畸形数据报")
+	flag.IntVar(&config.DownRate, "down-rate", 0, "请求服务端下行发送的速率（包/秒），0表示不启用")
+	flag.IntVar(&config.DownSize, "down-size", 0, "下行数据包大小（字节），默认与 -size 相同")
+	flag.IntVar(&config.BulkStreams, "bulk-streams", 0, "混合测试：同时在可靠流上发送批量数据的流数，0表示不启用")
+	flag.StringVar(&config.BulkRate, "bulk-rate", "", "每条批量数据流的目标比特率，例如 20M，默认尽快发送")
+	flag.IntVar(&config.Connections, "connections", 1, "并发建立的独立连接数，每个连接有独立的发送和统计")
+	flag.DurationVar(&config.Stagger, "stagger", 100*time.Millisecond, "多连接测试中相邻两个连接开始建立的间隔")
+	flag.StringVar(&config.Compare, "compare", "", "对照测试：依次用列出的传输方式运行相同负载，例如 udp,native,stream,webtransport,h3,masque")
+	flag.StringVar(&config.UDPServer, "udp-server", "", "对照测试中裸UDP服务端的地址，例如 localhost:4364")
+	flag.StringVar(&config.Flows, "flows", "", "多个并发流，格式 流ID:包大小:速率[:负载类型]，逗号分隔，例如 1:160:50,2:1200:500")
+	flag.BoolVar(&config.ProbeSize, "probe-size", true, "测试前探测可用的最大数据报负载")
+	flag.BoolVar(&config.ClampSize, "clamp-size", true, "-size 超出探测到的上限时自动缩小，设为false则拒绝运行")
+	flag.BoolVar(&config.Saturate, "saturate", false, "饱和测试：自动提升发送速率，寻找满足阈值的最高速率")
+	flag.Float64Var(&config.MaxLoss, "max-loss", 1.0, "饱和测试的丢包率阈值（百分比）")
+	flag.DurationVar(&config.MaxLatencyGrowth, "max-latency-growth", 20*time.Millisecond, "饱和测试的延迟增长阈值（相对第一档的p50）")
+	flag.DurationVar(&config.StepDuration, "step-duration", 3*time.Second, "饱和测试和矩阵测试每一步的持续时间")
+	flag.DurationVar(&config.Settle, "settle", 500*time.Millisecond, "饱和测试和矩阵测试每一步结束后等待在途数据报的时间")
+	flag.IntVar(&config.MaxRate, "max-rate", 1000000, "饱和测试的速率上限（包/秒）")
+	flag.IntVar(&config.SaturateIterations, "saturate-iterations", 6, "饱和测试二分查找的最大次数")
+	flag.StringVar(&config.Sizes, "sizes", "", "矩阵测试的包大小列表或范围，例如 64,256,1024,1200 或 200-1200:200")
+	flag.StringVar(&config.Rates, "rates", "", "矩阵测试的速率列表或范围（包/秒），例如 100,1000,5000")
+	flag.StringVar(&config.CSVFile, "csv", "", "将矩阵测试结果写入CSV文件")
+	flag.StringVar(&config.Output, "output", OutputText, "输出格式: text 或 json")
+	flag.StringVar(&config.OutputFile, "output-file", "", "将JSON结果和周期快照写入指定文件")
+	flag.BoolVar(&config.Verbose, "verbose", false, "逐包输出收到的下行数据报，高速率下会成为瓶颈")
 	flag.Parse()
 
-	client := &Client{config: config}
+	reporter, err := NewReporter(config.Output, config.OutputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reporter.Close()
+	out := reporter.Text()
 
-	var err error
-	if config.Mode == "libp2p" {
-		if config.PeerAddr == "" {
-			log.Fatal("libp2p模式需要指定 -peer 参数")
-		}
-		
-		cfg, err := LoadOrCreateConfig()
+	var bitrate float64
+	if config.Bitrate != "" {
+		bitrate, err = ParseBitrate(config.Bitrate)
 		if err != nil {
-			log.Fatalf("加载配置失败: %v", err)
+			log.Fatal(err)
+		}
+	} else if config.SendRate <= 0 {
+		log.Fatal("-rate 必须大于0")
+	}
+	if config.Saturate {
+		if config.MaxRate <= 0 {
+			log.Fatal("-max-rate 必须大于0")
+		}
+		if bitrate == 0 && config.MaxRate < config.SendRate {
+			log.Fatalf("-max-rate (%d) 不能小于起始速率 -rate (%d)", config.MaxRate, config.SendRate)
+		}
+	}
+	if config.DownSize == 0 {
+		config.DownSize = config.PacketSize
+	}
+	if config.PacketSize < HeaderLen || config.DownSize < HeaderLen {
+		log.Fatalf("包大小不能小于数据报头部长度 %d 字节", HeaderLen)
+	}
+	if config.PacketSize > MaxPacketSize || config.DownSize > MaxPacketSize {
+		log.Fatalf("包大小不能超过 %d 字节（头部的负载长度字段为2字节）", MaxPacketSize)
+	}
+
+	var flows []FlowSpec
+	if config.Flows != "" {
+		if flows, err = ParseFlowSpecs(config.Flows, config.PayloadType); err != nil {
+			log.Fatalf("-flows: %v", err)
+		}
+		if bitrate > 0 || config.Saturate || config.Sizes != "" || config.Rates != "" {
+			log.Fatal("-flows 不能与 -bitrate、-saturate、-sizes 或 -rates 同时使用")
+		}
+	}
+	var bulkBitrate float64
+	if config.BulkStreams > 0 {
+		if config.BulkRate != "" {
+			if bulkBitrate, err = ParseBitrate(config.BulkRate); err != nil {
+				log.Fatalf("-bulk-rate: %v", err)
+			}
+		}
+		if config.Flows != "" || config.Connections > 1 || config.Saturate || config.Sizes != "" || config.Rates != "" {
+			log.Fatal("-bulk-streams 不能与 -flows、-connections、-saturate、-sizes 或 -rates 同时使用")
 		}
+	}
+	if config.Connections < 1 {
+		log.Fatal("-connections 必须大于0")
+	}
+	if config.Connections > 1 && (config.Saturate || config.Sizes != "" || config.Rates != "") {
+		log.Fatal("-connections 不能与 -saturate、-sizes 或 -rates 同时使用")
+	}
 
-		fmt.Printf("使用LibP2P模式连接到: %s\n", config.PeerAddr)
-		if err := client.connectLibP2P(cfg); err != nil {
-			log.Fatal("连接失败:", err)
+	var compare []string
+	if config.Compare != "" {
+		if compare, err = ParseCompareModes(config.Compare); err != nil {
+			log.Fatalf("-compare: %v", err)
 		}
-	} else {
-		fmt.Printf("使用Native模式连接到服务器: %s\n", config.ServerAddr)
-		if err = client.connectNative(); err != nil {
-			log.Fatal("连接失败:", err)
+		if config.Flows != "" || config.BulkStreams > 0 || config.Connections > 1 || config.Saturate || config.Sizes != "" || config.Rates != "" {
+			log.Fatal("-compare 不能与 -flows、-bulk-streams、-connections、-saturate、-sizes 或 -rates 同时使用")
 		}
+		for _, mode := range compare {
+			if (mode == "udp" || mode == "masque") && config.UDPServer == "" {
+				log.Fatal("对照测试包含udp或masque时需要指定 -udp-server (服务端使用 -udp-addr 监听)")
+			}
+		}
+		runCompare(config, reporter, bitrate, compare)
+		return
+	}
+
+	var p2pConfig *Config
+	if config.Mode == "libp2p" || config.Mode == "libp2p-webrtc" {
+		if (config.Discover || config.DiscoverList) && config.Mode != "libp2p" {
+			log.Fatal("mDNS发现只支持libp2p模式，libp2p不在mDNS中通告webrtc-direct地址")
+		}
+		if config.DiscoverList {
+			found, err := discoverServers(config.DiscoverWait, nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			printDiscovered(out, found)
+			return
+		}
+		if config.Discover && (config.Rendezvous != "" || strings.HasPrefix(config.PeerAddr, "/")) {
+			log.Fatal("-discover 不能与 -rendezvous 或完整multiaddr的 -peer 同时使用")
+		}
+		if config.PeerAddr == "" && config.Rendezvous == "" && !config.Discover {
+			log.Fatal("libp2p模式需要指定 -peer、-rendezvous 或 -discover 参数")
+		}
+		if p2pConfig, err = LoadOrCreateConfig(out); err != nil {
+			log.Fatalf("加载配置失败: %v", err)
+		}
+		// 局域网内的服务端可能与客户端共用 HOME 中的身份，mDNS发现时使用临时身份
+		if config.Discover {
+			key, err := GenerateRandomKey()
+			if err != nil {
+				log.Fatalf("生成临时身份失败: %v", err)
+			}
+			p2pConfig.PrivateKey = key
+		}
+	}
+
+	if config.Connections > 1 {
+		runMultiClient(config, reporter, bitrate, flows, p2pConfig)
+		return
+	}
+
+	client := newClient(config, reporter, flows)
+	if err := client.connect(p2pConfig); err != nil {
+		log.Fatal("连接失败:", err)
 	}
 	defer client.conn.Close()
 
-	fmt.Printf("连接成功，开始性能测试...\n")
+	fmt.Fprintf(out, "连接成功，开始性能测试...\n")
 
-	// 发送数据包
-	client.sendPackets()
+	// 接收回显、下行数据报和控制响应
+	stopReceive := client.startReceive()
 
-	// 等待一小段时间确保最后的包被发送
-	time.Sleep(100 * time.Millisecond)
+	if err := client.prepare(bitrate); err != nil {
+		log.Fatal(err)
+	}
+	// 包大小和速率可能被调整，后续使用调整后的配置
+	config = client.config
+
+	if client.bulkEnabled() {
+		start := time.Now()
+		result, err := client.runInterference(bulkBitrate)
+		stopReceive()
+		if err != nil {
+			log.Fatal("混合测试失败: ", err)
+		}
+		result.Print(out)
+		client.reportInterference(result, start)
+		return
+	}
+
+	if client.sweepEnabled() {
+		start := time.Now()
+		steps, err := client.runSweep(bitrate)
+		stopReceive()
+		if len(steps) > 0 {
+			PrintSweep(out, steps, wireOverhead(config.Mode))
+			if config.CSVFile != "" {
+				if err := WriteSweepCSV(config.CSVFile, steps, wireOverhead(config.Mode)); err != nil {
+					fmt.Fprintf(out, "%v\n", err)
+				} else {
+					fmt.Fprintf(out, "CSV结果已写入: %s\n", config.CSVFile)
+				}
+			}
+			client.reportSweep(steps, start)
+		}
+		if err != nil {
+			log.Fatal("矩阵测试失败: ", err)
+		}
+		return
+	}
+
+	if config.Saturate {
+		start := time.Now()
+		result, err := client.runSaturation()
+		stopReceive()
+		if err != nil {
+			log.Fatal("饱和测试失败: ", err)
+		}
+		result.Print(out, config.PacketSize, wireOverhead(config.Mode))
+		client.reportSaturation(result, start)
+		return
+	}
+
+	serverResult, serverFlows, err := client.runTest()
+	if err != nil {
+		log.Fatal(err)
+	}
+	stopReceive()
 
 	// 打印最终统计
-	client.stats.PrintFinal(config.PacketSize)
+	if client.flowsEnabled() {
+		client.printClientFlows()
+	} else {
+		client.stats.PrintFinal(out, "客户端发送统计", config.PacketSize)
+	}
+	if client.downlinkEnabled() {
+		client.downStats.PrintFinal(out, "下行接收统计")
+	}
+	if serverResult != nil {
+		PrintEndToEnd(out, client.snapshot(), *serverResult)
+	}
+	if serverFlows != nil {
+		PrintFlowTable(out, "各流端到端结果", serverFlows, client.flowSent())
+	}
+	client.reportResult(serverResult, serverFlows)
 
-	fmt.Printf("测试完成，保持连接5秒以查看服务器统计...\n")
-	time.Sleep(5 * time.Second)
+	if client.control == nil && serverResult == nil {
+		fmt.Fprintf(out, "测试完成，保持连接5秒以查看服务器统计...\n")
+		time.Sleep(5 * time.Second)
+	}
 }
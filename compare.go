@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// compareModes 对照测试支持的传输方式
+var compareModes = []string{"udp", "native", "stream", "webtransport", "h3", "masque"}
+
+// CompareResult 对照测试中同一负载在一种传输方式上的测量结果
+type CompareResult struct {
+	Mode    string           `json:"mode"`
+	SetupNs int64            `json:"setup_ns,omitempty"` // 建立连接（含握手）的耗时，裸UDP为0
+	Step    *MeasurementStep `json:"step,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// ParseCompareModes 解析逗号分隔的传输方式列表，例如 "udp,native,stream"
+func ParseCompareModes(s string) ([]string, error) {
+	var modes []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		mode := strings.TrimSpace(item)
+		if mode == "" {
+			continue
+		}
+		known := false
+		for _, m := range compareModes {
+			known = known || m == mode
+		}
+		if !known {
+			return nil, fmt.Errorf("不支持的传输方式 %q (可选: %s)", mode, strings.Join(compareModes, ", "))
+		}
+		if seen[mode] {
+			return nil, fmt.Errorf("传输方式 %q 重复", mode)
+		}
+		seen[mode] = true
+		modes = append(modes, mode)
+	}
+	if len(modes) == 0 {
+		return nil, fmt.Errorf("传输方式列表为空")
+	}
+	return modes, nil
+}
+
+// compareMode 以指定传输方式建立新连接，按相同的速率和包大小发送 -duration 并取回服务端统计
+func compareMode(out io.Writer, mode string, config ClientConfig, bitrate float64) CompareResult {
+	result := CompareResult{Mode: mode}
+
+	config.Mode = mode
+	if mode == "udp" || mode == "masque" {
+		config.ServerAddr = config.UDPServer
+	}
+	client := newClient(config, nil, nil)
+	client.out = out
+
+	fmt.Fprintf(out, "\n")
+	if err := client.connect(nil); err != nil {
+		result.Error = fmt.Sprintf("连接失败: %v", err)
+		fmt.Fprintf(out, "[%s] %s\n", mode, result.Error)
+		return result
+	}
+	defer client.conn.Close()
+	result.SetupNs = int64(client.setupTime)
+
+	stopReceive := client.startReceive()
+	defer stopReceive()
+
+	if err := client.prepare(bitrate); err != nil {
+		result.Error = err.Error()
+		fmt.Fprintf(out, "[%s] %v\n", mode, err)
+		return result
+	}
+
+	rate, size := client.config.SendRate, client.config.PacketSize
+	fmt.Fprintf(out, "[%s] 发送 %d pps, %d 字节, 持续 %v\n", mode, rate, size, config.Duration)
+	step, _, err := client.measureStep(rate, size, config.Duration, nil)
+	if err != nil {
+		result.Error = err.Error()
+		fmt.Fprintf(out, "[%s] 测量失败: %v\n", mode, err)
+		return result
+	}
+	result.Step = &step
+	return result
+}
+
+// runCompare 依次在每种传输方式上运行相同的负载：裸UDP、QUIC DATAGRAM帧、
+// 单条QUIC流上带长度前缀的消息，最后在同一张表中对比
+func runCompare(config ClientConfig, reporter *Reporter, bitrate float64, modes []string) {
+	out := reporter.Text()
+	fmt.Fprintf(out, "对照测试: %s，每种方式发送 %v\n", strings.Join(modes, ", "), config.Duration)
+
+	start := time.Now()
+	var results []CompareResult
+	for i, mode := range modes {
+		if i > 0 {
+			time.Sleep(config.Settle)
+		}
+		results = append(results, compareMode(out, mode, config, bitrate))
+	}
+
+	PrintCompare(out, results)
+
+	if reporter.Enabled() {
+		reporter.Write(ResultDocument{
+			Type:      "result",
+			Role:      "client",
+			Mode:      config.Mode,
+			Version:   Version,
+			StartTime: start,
+			EndTime:   time.Now(),
+			Params:    config,
+			Compare:   results,
+		})
+	}
+}
+
+// PrintCompare 打印各传输方式的对照结果
+func PrintCompare(w io.Writer, results []CompareResult) {
+	fmt.Fprintf(w, "\n=== 传输方式对照结果 ===\n")
+	fmt.Fprintf(w, "%-12s %12s %8s %10s %12s %10s %10s %10s %12s %12s %12s %14s\n",
+		"方式", "建立耗时", "包大小", "速率(pps)", "实际速率", "发送", "接收", "丢包率", "p50", "p99", "平均抖动", "有效吞吐")
+	for _, r := range results {
+		setup := "-"
+		if r.SetupNs > 0 {
+			setup = time.Duration(r.SetupNs).Round(time.Microsecond).String()
+		}
+		if r.Step == nil {
+			fmt.Fprintf(w, "%-12s %12s  %s\n", r.Mode, setup, r.Error)
+			continue
+		}
+		step := r.Step
+		fmt.Fprintf(w, "%-12s %12s %8d %10d %12.2f %10d %10d %9.2f%% %12v %12v %12v %14s\n",
+			r.Mode, setup, step.Size, step.Rate, step.AchievedRate, step.Sent, step.Received, step.LossRate*100,
+			time.Duration(step.P50Ns), time.Duration(step.P99Ns), time.Duration(step.JitterNs), FormatBitrate(step.GoodputBps))
+	}
+	fmt.Fprintf(w, "udp: 裸UDP数据报; native: QUIC DATAGRAM帧; stream: 单条QUIC流上带长度前缀的消息; webtransport: WebTransport会话数据报;\n")
+	fmt.Fprintf(w, "h3: HTTP/3请求流上的HTTP数据报; masque: 经CONNECT-UDP代理转发到裸UDP服务端\n")
+	fmt.Fprintf(w, "========================\n")
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,8 +28,8 @@ type Config struct {
 	ConfigDir      string
 }
 
-// LoadOrCreateConfig 加载或创建配置
-func LoadOrCreateConfig() (*Config, error) {
+// LoadOrCreateConfig 加载或创建配置，加载过程的信息写入 out
+func LoadOrCreateConfig(out io.Writer) (*Config, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("获取用户目录失败: %w", err)
@@ -42,19 +43,19 @@ func LoadOrCreateConfig() (*Config, error) {
 	config := &Config{ConfigDir: configDir}
 
 	// 加载或生成私钥
-	if err := config.loadOrCreatePrivateKey(); err != nil {
+	if err := config.loadOrCreatePrivateKey(out); err != nil {
 		return nil, err
 	}
 
 	// 加载bootstrap节点
-	if err := config.loadBootstrapNodes(); err != nil {
+	if err := config.loadBootstrapNodes(out); err != nil {
 		return nil, err
 	}
 
 	return config, nil
 }
 
-func (c *Config) loadOrCreatePrivateKey() error {
+func (c *Config) loadOrCreatePrivateKey(out io.Writer) error {
 	keyPath := filepath.Join(c.ConfigDir, privateKeyFileName)
 	peerIDPath := filepath.Join(c.ConfigDir, peerIDFileName)
 
@@ -77,12 +78,12 @@ func (c *Config) loadOrCreatePrivateKey() error {
 
 		c.PrivateKey = privKey
 		c.PeerID = peerID
-		fmt.Printf("已加载现有密钥，Peer ID: %s\n", peerID)
+		fmt.Fprintf(out, "已加载现有密钥，Peer ID: %s\n", peerID)
 		return nil
 	}
 
 	// 生成新私钥
-	fmt.Println("未找到现有密钥，正在生成新密钥...")
+	fmt.Fprintln(out, "未找到现有密钥，正在生成新密钥...")
 	privKey, err := GenerateRandomKey()
 	if err != nil {
 		return fmt.Errorf("生成密钥对失败: %w", err)
@@ -111,12 +112,12 @@ func (c *Config) loadOrCreatePrivateKey() error {
 
 	c.PrivateKey = privKey
 	c.PeerID = peerID
-	fmt.Printf("已生成新密钥，Peer ID: %s\n", peerID)
-	fmt.Printf("配置已保存到: %s\n", c.ConfigDir)
+	fmt.Fprintf(out, "已生成新密钥，Peer ID: %s\n", peerID)
+	fmt.Fprintf(out, "配置已保存到: %s\n", c.ConfigDir)
 	return nil
 }
 
-func (c *Config) loadBootstrapNodes() error {
+func (c *Config) loadBootstrapNodes(out io.Writer) error {
 	bootstrapPath := filepath.Join(c.ConfigDir, bootstrapFileName)
 
 	data, err := os.ReadFile(bootstrapPath)
@@ -131,8 +132,8 @@ func (c *Config) loadBootstrapNodes() error {
 			if err := os.WriteFile(bootstrapPath, []byte(example), 0644); err != nil {
 				return fmt.Errorf("创建bootstrap配置文件失败: %w", err)
 			}
-			fmt.Printf("已创建bootstrap配置文件: %s\n", bootstrapPath)
-			fmt.Println("请编辑该文件添加bootstrap节点地址")
+			fmt.Fprintf(out, "已创建bootstrap配置文件: %s\n", bootstrapPath)
+			fmt.Fprintln(out, "请编辑该文件添加bootstrap节点地址")
 			return nil
 		}
 		return fmt.Errorf("读取bootstrap配置失败: %w", err)
@@ -149,7 +150,7 @@ func (c *Config) loadBootstrapNodes() error {
 	}
 
 	if len(c.BootstrapNodes) > 0 {
-		fmt.Printf("已加载 %d 个bootstrap节点\n", len(c.BootstrapNodes))
+		fmt.Fprintf(out, "已加载 %d 个bootstrap节点\n", len(c.BootstrapNodes))
 	}
 
 	return scanner.Err()
@@ -2,18 +2,52 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/quic-go/quic-go"
 )
 
-// Connection 是一个通用的连接接口，支持native和libp2p两种模式
+// errStreamsUnsupported 连接没有可用的可靠流（裸UDP、HTTP数据报），控制流和批量数据流都不可用，
+// 客户端改用控制数据报获取服务端统计
+var errStreamsUnsupported = errors.New("该模式不支持可靠流")
+
+// Connection 是一个通用的连接接口，支持native、libp2p、webtransport、HTTP数据报（h3、masque）以及作为对照的stream和udp模式
 type Connection interface {
 	SendDatagram(data []byte) error
 	ReceiveDatagram(ctx context.Context) ([]byte, error)
+	// OpenStream 打开与数据报共用连接的可靠流（控制流或批量数据流）
+	OpenStream(ctx context.Context) (Stream, error)
+	// AcceptStream 等待对端打开可靠流
+	AcceptStream(ctx context.Context) (Stream, error)
 	Close() error
 	RemoteAddr() string
 }
 
+// Stream 可靠的双向字节流，Close 关闭写方向
+type Stream interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// interruptRead 在ctx取消时以读超时打断阻塞的读取。读取结束后调用返回的函数：
+// 若读超时已被设置，等设置完成后清除它，之后的读取不受影响
+func interruptRead(ctx context.Context, setReadDeadline func(time.Time) error) (done func()) {
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		setReadDeadline(time.Now())
+		close(interrupted)
+	})
+	return func() {
+		if !stop() {
+			<-interrupted
+			setReadDeadline(time.Time{})
+		}
+	}
+}
+
 // NativeConnection 包装原生QUIC连接
 type NativeConnection struct {
 	conn *quic.Conn
@@ -27,6 +61,22 @@ func (c *NativeConnection) ReceiveDatagram(ctx context.Context) ([]byte, error)
 	return c.conn.ReceiveDatagram(ctx)
 }
 
+func (c *NativeConnection) OpenStream(ctx context.Context) (Stream, error) {
+	stream, err := c.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *NativeConnection) AcceptStream(ctx context.Context) (Stream, error) {
+	stream, err := c.conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
 func (c *NativeConnection) Close() error {
 	return c.conn.CloseWithError(0, "")
 }
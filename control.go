@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 控制数据报使用与测试数据报相同的头部并设置 FlagControl，序列号为0，负载为：
+//
+//	[0]     消息类型
+//	[1:]    JSON编码的消息体
+const controlHeaderLen = HeaderLen + 1
+
+// ControlType 控制消息类型
+type ControlType byte
+
+const (
+	ControlDownlinkRequest ControlType = iota + 1 // 客户端请求服务端发送下行数据报
+	ControlDownlinkAck                            // 服务端确认已开始下行发送
+	ControlStatsReset                             // 客户端请求重置本会话的接收统计
+	ControlStatsResetAck                          // 服务端确认已重置
+	ControlStatsRequest                           // 客户端请求本会话当前的接收统计
+	ControlStatsReport                            // 服务端回复接收统计
+	ControlSizeProbe                              // 客户端发送的指定长度的尺寸探测
+	ControlSizeProbeAck                           // 服务端回复收到的探测长度
+)
+
+func (t ControlType) String() string {
+	switch t {
+	case ControlDownlinkRequest:
+		return "downlink-request"
+	case ControlDownlinkAck:
+		return "downlink-ack"
+	case ControlStatsReset:
+		return "stats-reset"
+	case ControlStatsResetAck:
+		return "stats-reset-ack"
+	case ControlStatsRequest:
+		return "stats-request"
+	case ControlStatsReport:
+		return "stats-report"
+	case ControlSizeProbe:
+		return "size-probe"
+	case ControlSizeProbeAck:
+		return "size-probe-ack"
+	default:
+		return fmt.Sprintf("control-%d", byte(t))
+	}
+}
+
+// 控制请求可能丢失而被重发，服务端对每个请求都会回复。
+// 每个请求带有ID，响应原样带回，客户端据此丢弃过期的重复响应。
+// 会改变服务端状态的请求（如重置）需要是幂等的。
+
+// ControlHeader 所有控制消息共有的字段
+type ControlHeader struct {
+	ID uint64 `json:"id"`
+}
+
+// SetID 设置请求ID
+func (h *ControlHeader) SetID(id uint64) {
+	h.ID = id
+}
+
+// ControlMessage 可以携带请求ID的控制消息
+type ControlMessage interface {
+	SetID(id uint64)
+}
+
+// DownlinkRequest 客户端请求的下行发送参数，也作为确认消息的消息体
+type DownlinkRequest struct {
+	ControlHeader
+	Rate        int           `json:"rate"`
+	Size        int           `json:"size"`
+	Duration    time.Duration `json:"duration"`
+	PayloadType string        `json:"payload_type"`
+	Checksum    bool          `json:"checksum,omitempty"`
+}
+
+// StatsResetRequest 请求重置接收统计，相同 Epoch 的重复请求只生效一次
+type StatsResetRequest struct {
+	ControlHeader
+	Epoch uint64 `json:"epoch"`
+}
+
+// StatsReport 服务端回复的接收统计
+type StatsReport struct {
+	ControlHeader
+	Stats     ServerSnapshot `json:"stats"`
+	BulkBytes int64          `json:"bulk_bytes,omitempty"` // 本会话从批量数据流累计收到的字节数
+}
+
+// SizeProbe 尺寸探测请求，编码时用空白填充到 Size 字节（JSON允许尾部空白）
+type SizeProbe struct {
+	ControlHeader
+	Size int `json:"size"`
+}
+
+// paddedSize 实现 paddedControl
+func (p *SizeProbe) paddedSize() int {
+	return p.Size
+}
+
+// SizeProbeAck 服务端收到的探测数据报长度
+type SizeProbeAck struct {
+	ControlHeader
+	Received int `json:"received"`
+}
+
+// paddedControl 需要填充到指定长度的控制消息
+type paddedControl interface {
+	paddedSize() int
+}
+
+// IsControl 判断数据报是否为控制消息
+func IsControl(data []byte) bool {
+	return hasFlag(data, FlagControl)
+}
+
+// EncodeControl 编码控制数据报
+func EncodeControl(t ControlType, msg any) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("编码控制消息失败: %w", err)
+	}
+
+	size := controlHeaderLen + len(body)
+	if p, ok := msg.(paddedControl); ok && p.paddedSize() > size {
+		size = p.paddedSize()
+	}
+
+	data := make([]byte, size)
+	header := Header{
+		Flags:      FlagControl,
+		Timestamp:  time.Now().UnixNano(),
+		PayloadLen: uint16(size - HeaderLen),
+	}
+	header.Encode(data)
+	data[HeaderLen] = byte(t)
+	n := copy(data[controlHeaderLen:], body)
+	for i := controlHeaderLen + n; i < size; i++ {
+		data[i] = ' '
+	}
+	return data, nil
+}
+
+// DecodeControl 解码控制数据报，返回消息类型和消息体
+func DecodeControl(data []byte) (ControlType, []byte, error) {
+	header, err := ParseHeader(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if header.Flags&FlagControl == 0 || len(data) < controlHeaderLen {
+		return 0, nil, fmt.Errorf("不是控制数据报")
+	}
+	return ControlType(data[HeaderLen]), data[controlHeaderLen:], nil
+}
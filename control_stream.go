@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 控制流与数据报共用同一连接，用于可靠地协商测试。
+// 消息为换行分隔的JSON，由客户端发起、服务端逐条应答：
+//
+//	客户端 params -> 服务端 ready    声明测试参数
+//	客户端 start  -> 服务端 started  服务端重置本会话统计，开始计入本次测试
+//	客户端 stop   -> 服务端 result   服务端结束本次测试，回复最终接收统计
+//
+// 服务端无法处理的请求以 error 应答。
+const (
+	StreamParams  = "params"
+	StreamReady   = "ready"
+	StreamStart   = "start"
+	StreamStarted = "started"
+	StreamStop    = "stop"
+	StreamResult  = "result"
+	StreamError   = "error"
+)
+
+// controlStreamTimeout 打开控制流和等待每条应答的超时时间
+const controlStreamTimeout = 5 * time.Second
+
+// TestParams 客户端声明的测试参数
+type TestParams struct {
+	Mode        string        `json:"mode"`
+	PacketSize  int           `json:"packet_size"`
+	SendRate    int           `json:"send_rate"`
+	Duration    time.Duration `json:"duration_ns"`
+	PayloadType string        `json:"payload_type"`
+	Echo        bool          `json:"echo"`
+	DownRate    int           `json:"down_rate,omitempty"`
+	DownSize    int           `json:"down_size,omitempty"`
+	Flows       []FlowSpec    `json:"flows,omitempty"` // 多流测试时各流的参数，此时忽略 PacketSize 和 SendRate
+}
+
+// StreamMessage 控制流上的消息
+type StreamMessage struct {
+	Type   string          `json:"type"`
+	Params *TestParams     `json:"params,omitempty"` // params
+	Sent   int64           `json:"sent,omitempty"`   // stop: 客户端成功发送的包数
+	Stats  *ServerSnapshot `json:"stats,omitempty"`  // result: 服务端本次测试的接收统计
+	Error  string          `json:"error,omitempty"`  // error
+
+	FlowSent map[uint32]int64 `json:"flow_sent,omitempty"` // stop: 多流测试时各流成功发送的包数
+	Flows    []FlowSnapshot   `json:"flows,omitempty"`     // result: 多流测试时各流的接收统计
+}
+
+// ControlStream 在可靠流上收发 StreamMessage
+type ControlStream struct {
+	stream  Stream
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func NewControlStream(stream Stream) *ControlStream {
+	return &ControlStream{
+		stream:  stream,
+		encoder: json.NewEncoder(stream),
+		decoder: json.NewDecoder(stream),
+	}
+}
+
+// Send 发送一条消息
+func (s *ControlStream) Send(msg StreamMessage) error {
+	if err := s.encoder.Encode(msg); err != nil {
+		return fmt.Errorf("发送控制流消息 %s 失败: %w", msg.Type, err)
+	}
+	return nil
+}
+
+// Receive 接收一条消息，timeout 为0时不设超时
+func (s *ControlStream) Receive(timeout time.Duration) (StreamMessage, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := s.stream.SetReadDeadline(deadline); err != nil {
+		return StreamMessage{}, err
+	}
+
+	var msg StreamMessage
+	if err := s.decoder.Decode(&msg); err != nil {
+		return StreamMessage{}, err
+	}
+	return msg, nil
+}
+
+// Request 发送请求并等待指定类型的应答
+func (s *ControlStream) Request(msg StreamMessage, respType string) (StreamMessage, error) {
+	if err := s.Send(msg); err != nil {
+		return StreamMessage{}, err
+	}
+
+	resp, err := s.Receive(controlStreamTimeout)
+	if err != nil {
+		return StreamMessage{}, fmt.Errorf("等待 %s 的应答失败: %w", msg.Type, err)
+	}
+	if resp.Type == StreamError {
+		return StreamMessage{}, fmt.Errorf("服务端拒绝 %s: %s", msg.Type, resp.Error)
+	}
+	if resp.Type != respType {
+		return StreamMessage{}, fmt.Errorf("%s 收到意外的应答 %s", msg.Type, resp.Type)
+	}
+	return resp, nil
+}
+
+// Close 关闭控制流的写方向
+func (s *ControlStream) Close() error {
+	return s.stream.Close()
+}
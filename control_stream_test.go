@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestControlStreamRequest(t *testing.T) {
+	params := &TestParams{Mode: "native", PacketSize: 1200, SendRate: 100, Duration: 10 * time.Second, PayloadType: "random", Echo: true}
+
+	tests := []struct {
+		name     string
+		req      StreamMessage
+		respType string
+		reply    StreamMessage
+		wantErr  bool
+	}{
+		{"声明参数", StreamMessage{Type: StreamParams, Params: params}, StreamReady, StreamMessage{Type: StreamReady}, false},
+		{"结束并取回统计", StreamMessage{Type: StreamStop, Sent: 1000}, StreamResult,
+			StreamMessage{Type: StreamResult, Stats: &ServerSnapshot{Received: 990, Bytes: 990 * 1200, Lost: 10, LossRate: 0.01}}, false},
+		{"服务端拒绝", StreamMessage{Type: StreamStart}, StreamStarted, StreamMessage{Type: StreamError, Error: "未声明测试参数"}, true},
+		{"意外的应答类型", StreamMessage{Type: StreamStart}, StreamStarted, StreamMessage{Type: StreamReady}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+			client, server := NewControlStream(clientConn), NewControlStream(serverConn)
+
+			received := make(chan StreamMessage, 1)
+			go func() {
+				msg, err := server.Receive(controlStreamTimeout)
+				if err != nil {
+					close(received)
+					return
+				}
+				received <- msg
+				server.Send(tt.reply)
+			}()
+
+			resp, err := client.Request(tt.req, tt.respType)
+			if got, ok := <-received; !ok || !reflect.DeepEqual(got, tt.req) {
+				t.Fatalf("服务端收到 %+v, want %+v", got, tt.req)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Request err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(resp, tt.reply) {
+				t.Errorf("应答 = %+v, want %+v", resp, tt.reply)
+			}
+		})
+	}
+}
+
+func TestControlStreamReceiveTimeout(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	start := time.Now()
+	_, err := NewControlStream(clientConn).Receive(50 * time.Millisecond)
+	if err == nil {
+		t.Fatal("没有消息时 Receive 应超时")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Receive 在 %v 后才返回", elapsed)
+	}
+}
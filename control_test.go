@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestControlRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      ControlType
+		msg      ControlMessage
+		decoded  ControlMessage // 解码目标
+		wantSize int            // 0表示不检查
+	}{
+		{"下行请求", ControlDownlinkRequest,
+			&DownlinkRequest{ControlHeader: ControlHeader{ID: 7}, Rate: 100, Size: 1200, Duration: 10 * time.Second, PayloadType: "random"},
+			&DownlinkRequest{}, 0},
+		{"下行确认", ControlDownlinkAck, &DownlinkRequest{ControlHeader: ControlHeader{ID: 7}, Rate: 100}, &DownlinkRequest{}, 0},
+		{"重置统计", ControlStatsReset, &StatsResetRequest{ControlHeader: ControlHeader{ID: 8}, Epoch: 2}, &StatsResetRequest{}, 0},
+		{"尺寸探测填充到指定长度", ControlSizeProbe, &SizeProbe{ControlHeader: ControlHeader{ID: 9}, Size: 1200}, &SizeProbe{}, 1200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeControl(tt.typ, tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsControl(data) {
+				t.Fatal("IsControl = false")
+			}
+			if tt.wantSize > 0 && len(data) != tt.wantSize {
+				t.Errorf("编码后 %d 字节, want %d", len(data), tt.wantSize)
+			}
+
+			typ, body, err := DecodeControl(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ != tt.typ {
+				t.Errorf("类型 = %v, want %v", typ, tt.typ)
+			}
+			if err := json.Unmarshal(body, tt.decoded); err != nil {
+				t.Fatalf("解码消息体失败: %v", err)
+			}
+			if !reflect.DeepEqual(tt.decoded, tt.msg) {
+				t.Errorf("消息体 = %+v, want %+v", tt.decoded, tt.msg)
+			}
+		})
+	}
+}
+
+func TestDecodeControlRejectsTestDatagram(t *testing.T) {
+	data := GeneratePayload(Header{Seq: 1}, 64, "random")
+	if IsControl(data) {
+		t.Error("测试数据报被识别为控制消息")
+	}
+	if _, _, err := DecodeControl(data); err == nil {
+		t.Error("解码测试数据报应返回错误")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/records"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+)
+
+// 测试节点之间的Kademlia DHT使用go-libp2p-kad-dht，协议前缀为 dhtProtocolPrefix，
+// 只在本工具的节点之间使用，不与IPFS公共DHT互通。服务端通过routing discovery把自己登记为
+// rendezvous命名空间的提供者，客户端按Peer ID或命名空间查找服务端。
+const dhtProtocolPrefix = protocol.ID("/quic-datagram-test")
+
+const (
+	// dhtDialTimeout 连接单个bootstrap节点的超时时间
+	dhtDialTimeout = 10 * time.Second
+	// dhtLookupTimeout 连接bootstrap节点并完成查找的总超时时间
+	dhtLookupTimeout = 30 * time.Second
+	// advertiseRetryInterval 登记失败后重试的间隔
+	advertiseRetryInterval = time.Minute
+	// defaultRendezvous 服务端默认登记的rendezvous命名空间
+	defaultRendezvous = "quic-datagram-test"
+
+	// maxProviderKeys 本节点最多为多少个键保存提供者记录
+	maxProviderKeys = 1024
+	// maxProvidersPerKey 每个键最多保存的提供者数
+	maxProvidersPerKey = 64
+	// providerPruneInterval 达到上限时清理过期记录的最小间隔
+	providerPruneInterval = time.Minute
+)
+
+var errProviderLimit = errors.New("提供者记录已达上限")
+
+// newDHT 在 h 上运行DHT。server为true时应答其他节点的查询并保存它们登记的提供者记录，
+// 否则只发起查询
+func newDHT(ctx context.Context, h host.Host, server bool) (*dht.IpfsDHT, error) {
+	providers, err := records.NewProviderManager(ctx, h.ID(), h.Peerstore(), dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		return nil, err
+	}
+	mode := dht.ModeClient
+	if server {
+		mode = dht.ModeServer
+	}
+	kad, err := dht.New(ctx, h,
+		dht.Mode(mode),
+		dht.ProtocolPrefix(dhtProtocolPrefix),
+		dht.ProviderStore(newBoundedProviderStore(providers)),
+	)
+	if err != nil {
+		providers.Close()
+		return nil, err
+	}
+	return kad, nil
+}
+
+// joinDHT 连接bootstrap节点，等它们进入路由表后刷新路由表，返回成功连接的bootstrap节点数
+func joinDHT(ctx context.Context, kad *dht.IpfsDHT, addrs []string, out io.Writer) int {
+	h := kad.Host()
+	connected := 0
+	for _, s := range addrs {
+		info, err := peer.AddrInfoFromString(s)
+		if err != nil {
+			fmt.Fprintf(out, "bootstrap节点地址无效 %s: %v\n", s, err)
+			continue
+		}
+		if info.ID == h.ID() {
+			continue
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, dhtDialTimeout)
+		err = h.Connect(dialCtx, *info)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(out, "连接bootstrap节点 %s 失败: %v\n", info.ID, err)
+			continue
+		}
+		connected++
+	}
+	if connected == 0 {
+		return 0
+	}
+
+	// 对方的协议识别完成后才进入路由表，在此之前刷新路由表不会询问任何节点
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for kad.RoutingTable().Size() == 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			fmt.Fprintln(out, "bootstrap节点没有应答DHT查询")
+			return connected
+		}
+	}
+	select {
+	case <-kad.RefreshRoutingTable():
+	case <-ctx.Done():
+	}
+	return connected
+}
+
+// advertise 周期性地在命名空间 ns 下登记本节点，直到ctx取消
+func advertise(ctx context.Context, kad *dht.IpfsDHT, ns string, out io.Writer) {
+	discovery := drouting.NewRoutingDiscovery(kad)
+	for {
+		ttl, err := discovery.Advertise(ctx, ns)
+		wait := ttl * 7 / 8
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(out, "在rendezvous命名空间 %q 下登记失败: %v\n", ns, err)
+			wait = advertiseRetryInterval
+		} else {
+			fmt.Fprintf(out, "已在rendezvous命名空间 %q 下登记\n", ns)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// findProviders 查找在命名空间 ns 下登记的节点，不包括本节点和没有地址的节点
+func findProviders(ctx context.Context, kad *dht.IpfsDHT, ns string) ([]peer.AddrInfo, error) {
+	found, err := dutil.FindPeers(ctx, drouting.NewRoutingDiscovery(kad), ns)
+	if err != nil {
+		return nil, err
+	}
+	var result []peer.AddrInfo
+	for _, info := range found {
+		if info.ID != kad.Host().ID() && len(info.Addrs) > 0 {
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+// boundedProviderStore 在kad-dht的提供者记录存储之前限制记录数。DHT中的任何节点都能登记，
+// 不加限制时可以用大量不同的键耗尽服务端的内存。
+// 记录与内层存储一样在 records.ProvideValidity 后过期，过期的记录不占用名额
+type boundedProviderStore struct {
+	records.ProviderStore
+
+	mutex  sync.Mutex
+	expiry map[string]map[peer.ID]time.Time // 键 -> 提供者 -> 过期时间
+	pruned time.Time
+}
+
+func newBoundedProviderStore(inner records.ProviderStore) *boundedProviderStore {
+	return &boundedProviderStore{
+		ProviderStore: inner,
+		expiry:        make(map[string]map[peer.ID]time.Time),
+	}
+}
+
+func (s *boundedProviderStore) AddProvider(ctx context.Context, key []byte, prov peer.AddrInfo) error {
+	if err := s.admit(string(key), prov.ID, time.Now()); err != nil {
+		return err
+	}
+	return s.ProviderStore.AddProvider(ctx, key, prov)
+}
+
+// admit 检查上限并记录过期时间，已有的提供者重新登记时只延长有效期
+func (s *boundedProviderStore) admit(key string, id peer.ID, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	full := func() bool {
+		providers, ok := s.expiry[key]
+		if !ok {
+			return len(s.expiry) >= maxProviderKeys
+		}
+		_, known := providers[id]
+		return !known && len(providers) >= maxProvidersPerKey
+	}
+	if full() && now.Sub(s.pruned) >= providerPruneInterval {
+		s.prune(now)
+	}
+	if full() {
+		return errProviderLimit
+	}
+
+	providers := s.expiry[key]
+	if providers == nil {
+		providers = make(map[peer.ID]time.Time)
+		s.expiry[key] = providers
+	}
+	providers[id] = now.Add(records.ProvideValidity)
+	return nil
+}
+
+// prune 删除过期的记录，调用时必须持有锁
+func (s *boundedProviderStore) prune(now time.Time) {
+	for key, providers := range s.expiry {
+		for id, expiry := range providers {
+			if now.After(expiry) {
+				delete(providers, id)
+			}
+		}
+		if len(providers) == 0 {
+			delete(s.expiry, key)
+		}
+	}
+	s.pruned = now
+}
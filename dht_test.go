@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/records"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	tpt "github.com/libp2p/go-libp2p/core/transport"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+)
+
+// newTestHost 创建只监听回环地址的libp2p QUIC host
+func newTestHost(t *testing.T) host.Host {
+	t.Helper()
+	key, err := GenerateRandomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := makeDatagramTransport("libp2p", &Config{PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := libp2p.New(
+		libp2p.Identity(key),
+		libp2p.Transport(func() (tpt.Transport, error) { return transport, nil }),
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/udp/0/quic-v1"),
+		libp2p.DisableRelay(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// hostAddr 返回 h 的完整multiaddr，用作bootstrap节点地址
+func hostAddr(h host.Host) string {
+	return h.Addrs()[0].String() + "/p2p/" + h.ID().String()
+}
+
+// randomPeers 生成 n 个随机的Peer ID
+func randomPeers(t *testing.T, n int) []peer.ID {
+	t.Helper()
+	var ids []peer.ID
+	for range n {
+		key, err := GenerateRandomKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestBoundedProviderStoreLimits(t *testing.T) {
+	s := newBoundedProviderStore(nil)
+	now := time.Now()
+	peers := randomPeers(t, maxProvidersPerKey+1)
+
+	for _, p := range peers[:maxProvidersPerKey] {
+		if err := s.admit("ns", p, now); err != nil {
+			t.Fatalf("上限内的登记失败: %v", err)
+		}
+	}
+	if err := s.admit("ns", peers[maxProvidersPerKey], now); !errors.Is(err, errProviderLimit) {
+		t.Errorf("超过每个键的提供者上限 err = %v, want %v", err, errProviderLimit)
+	}
+	if err := s.admit("ns", peers[0], now); err != nil {
+		t.Errorf("已有的提供者重新登记失败: %v", err)
+	}
+
+	for i := 1; i < maxProviderKeys; i++ {
+		if err := s.admit(fmt.Sprintf("key-%d", i), peers[0], now); err != nil {
+			t.Fatalf("第 %d 个键登记失败: %v", i, err)
+		}
+	}
+	if err := s.admit("extra", peers[0], now); !errors.Is(err, errProviderLimit) {
+		t.Errorf("超过键的上限 err = %v, want %v", err, errProviderLimit)
+	}
+
+	// 过期的记录清理后不再占用名额
+	later := now.Add(records.ProvideValidity + time.Second)
+	if err := s.admit("extra", peers[0], later); err != nil {
+		t.Errorf("记录过期后登记失败: %v", err)
+	}
+	if len(s.expiry) != 1 {
+		t.Errorf("清理后剩余 %d 个键, want 1", len(s.expiry))
+	}
+}
+
+// TestDHTRendezvous 三个节点：bootstrap节点只应答查询，服务端经它登记命名空间，
+// 客户端经它按Peer ID和命名空间找到服务端
+func TestDHTRendezvous(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), dhtLookupTimeout)
+	defer cancel()
+
+	newTestDHT := func(server bool) *dht.IpfsDHT {
+		kad, err := newDHT(ctx, newTestHost(t), server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { kad.Close() })
+		return kad
+	}
+	bootstrap := newTestDHT(true)
+	server := newTestDHT(true)
+	client := newTestDHT(false)
+	bootstrapAddrs := []string{hostAddr(bootstrap.Host())}
+
+	if n := joinDHT(ctx, server, bootstrapAddrs, io.Discard); n != 1 {
+		t.Fatalf("服务端连接了 %d 个bootstrap节点", n)
+	}
+	if _, err := drouting.NewRoutingDiscovery(server).Advertise(ctx, "test"); err != nil {
+		t.Fatalf("登记命名空间失败: %v", err)
+	}
+	if n := joinDHT(ctx, client, bootstrapAddrs, io.Discard); n != 1 {
+		t.Fatalf("客户端连接了 %d 个bootstrap节点", n)
+	}
+
+	info, err := client.FindPeer(ctx, server.Host().ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Addrs) == 0 {
+		t.Fatal("找到的服务端没有地址")
+	}
+	if _, err := client.FindPeer(ctx, randomPeers(t, 1)[0]); err == nil {
+		t.Error("查找不存在的节点应返回错误")
+	}
+
+	providers, err := findProviders(ctx, client, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 1 || providers[0].ID != server.Host().ID() {
+		t.Fatalf("找到的提供者 = %v, want [%s]", providers, server.Host().ID())
+	}
+	if other, err := findProviders(ctx, client, "other"); err != nil || len(other) != 0 {
+		t.Errorf("未登记的命名空间找到 %v, err = %v", other, err)
+	}
+
+	// 找到的地址可以直接拨号
+	dialCtx, dialCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer dialCancel()
+	if err := client.Host().Connect(dialCtx, providers[0]); err != nil {
+		t.Fatalf("连接找到的服务端失败: %v", err)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FlowSpec 一个逻辑流的发送参数，多个流共享同一连接，以头部中的流ID区分
+type FlowSpec struct {
+	ID          uint32 `json:"id"`
+	Size        int    `json:"size"`
+	Rate        int    `json:"rate"`
+	PayloadType string `json:"payload_type"`
+}
+
+// ParseFlowSpecs 解析逗号分隔的流定义，每项为 "流ID:包大小:速率[:负载类型]"，
+// 例如 "1:160:50:random,2:1200:500,3:64:10:constant"。省略负载类型时使用 defaultPayload。
+func ParseFlowSpecs(s, defaultPayload string) ([]FlowSpec, error) {
+	var specs []FlowSpec
+	seen := make(map[uint32]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("无效的流定义 %q (格式: 流ID:包大小:速率[:负载类型])", item)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("流定义 %q 的流ID无效", item)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || size < HeaderLen || size > MaxPacketSize {
+			return nil, fmt.Errorf("流定义 %q 的包大小无效，需在数据报头部长度 %d 和 %d 字节之间", item, HeaderLen, MaxPacketSize)
+		}
+		rate, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("流定义 %q 的速率无效", item)
+		}
+		payloadType := defaultPayload
+		if len(parts) == 4 {
+			payloadType = strings.TrimSpace(parts[3])
+			switch payloadType {
+			case "random", "sequential", "constant":
+			default:
+				return nil, fmt.Errorf("流定义 %q 的负载类型无效 (random, sequential 或 constant)", item)
+			}
+		}
+		if seen[uint32(id)] {
+			return nil, fmt.Errorf("流ID %d 重复", id)
+		}
+		seen[uint32(id)] = true
+
+		specs = append(specs, FlowSpec{ID: uint32(id), Size: size, Rate: rate, PayloadType: payloadType})
+	}
+
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("流定义 %q 为空", s)
+	}
+	return specs, nil
+}
+
+// FlowSnapshot 单个流的接收统计快照
+type FlowSnapshot struct {
+	FlowID uint32 `json:"flow_id"`
+	ServerSnapshot
+}
+
+// ClientFlowSnapshot 客户端单个流的发送统计快照
+type ClientFlowSnapshot struct {
+	FlowID uint32 `json:"flow_id"`
+	ClientSnapshot
+}
+
+// maxFlows 每个会话最多分开统计的流数，超出后新流ID的数据报只计数。
+// 每个流的统计记录包含完整的接收窗口和直方图，限制流数避免发送方用任意流ID耗尽服务端内存
+const maxFlows = 256
+
+// FlowSet 按流ID分开的接收统计，每个流有独立的序列号空间、丢包和延迟记录。
+// 流只在数据报通过校验后创建，校验失败和超出流数上限的数据报统一计入 invalid
+type FlowSet struct {
+	mutex    sync.RWMutex
+	flows    map[uint32]*ServerStats
+	invalid  ServerStats
+	overhead int // 会话模式的每包协议开销，传给各流的统计记录
+}
+
+func NewFlowSet(overhead int) *FlowSet {
+	return &FlowSet{flows: make(map[uint32]*ServerStats), overhead: overhead}
+}
+
+// flow 返回指定流的统计记录，首次出现时创建；已达到流数上限时返回 nil
+func (f *FlowSet) flow(id uint32) *ServerStats {
+	f.mutex.RLock()
+	stats := f.flows[id]
+	f.mutex.RUnlock()
+	if stats != nil {
+		return stats
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if stats = f.flows[id]; stats == nil && len(f.flows) < maxFlows {
+		stats = &ServerStats{overhead: f.overhead}
+		f.flows[id] = stats
+	}
+	return stats
+}
+
+// ProcessPacket 校验数据报后交给其所属流的统计记录，out 接收丢包、乱序等事件
+func (f *FlowSet) ProcessPacket(data []byte, out io.Writer, verbose bool) {
+	now := time.Now()
+	header, err := CheckPacket(data)
+	if err != nil {
+		f.invalid.recordInvalid(header, len(data), err, out)
+		return
+	}
+
+	stats := f.flow(header.FlowID)
+	if stats == nil {
+		f.invalid.mutex.Lock()
+		f.invalid.UntrackedCount++
+		f.invalid.mutex.Unlock()
+		return
+	}
+	stats.track(header, len(data), now, out, verbose)
+}
+
+// Invalid 返回未通过校验或超出流数上限的数据报统计
+func (f *FlowSet) Invalid() *ServerStats {
+	return &f.invalid
+}
+
+// IDs 返回按流ID排序的已出现的流
+func (f *FlowSet) IDs() []uint32 {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	ids := make([]uint32, 0, len(f.flows))
+	for id := range f.flows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Len 返回已出现的流数
+func (f *FlowSet) Len() int {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return len(f.flows)
+}
+
+// Flow 返回指定流的统计记录，未出现过时返回 nil
+func (f *FlowSet) Flow(id uint32) *ServerStats {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.flows[id]
+}
+
+// Total 返回所有流和无效数据报合并后的统计记录副本
+func (f *FlowSet) Total() *ServerStats {
+	total := &ServerStats{}
+	total.MergeFrom(&f.invalid)
+	for _, id := range f.IDs() {
+		total.MergeFrom(f.Flow(id))
+	}
+	return total
+}
+
+// Snapshots 返回按流ID排序的各流快照
+func (f *FlowSet) Snapshots() []FlowSnapshot {
+	var snaps []FlowSnapshot
+	for _, id := range f.IDs() {
+		snaps = append(snaps, FlowSnapshot{FlowID: id, ServerSnapshot: f.Flow(id).Snapshot()})
+	}
+	return snaps
+}
+
+// PrintFlowTable 打印各流的接收统计对比表。sent 为客户端报告的各流发送数，
+// 不为空时附加发送数和端到端丢包率，用于观察同一连接内各流之间的公平性和队头阻塞。
+func PrintFlowTable(w io.Writer, title string, flows []FlowSnapshot, sent map[uint32]int64) {
+	fmt.Fprintf(w, "\n=== %s ===\n", title)
+	if sent != nil {
+		fmt.Fprintf(w, "%6s %10s %10s %10s %10s %8s %12s %12s %12s %14s\n",
+			"流", "发送", "接收", "端到端丢包", "丢包率", "乱序", "p50", "p99", "平均抖动", "有效吞吐")
+	} else {
+		fmt.Fprintf(w, "%6s %10s %10s %10s %8s %12s %12s %12s %14s\n",
+			"流", "接收", "丢失", "丢包率", "乱序", "p50", "p99", "平均抖动", "有效吞吐")
+	}
+	for _, flow := range flows {
+		if sent != nil {
+			missing := sent[flow.FlowID] - flow.Received
+			if missing < 0 {
+				missing = 0
+			}
+			lossRate := 0.0
+			if sent[flow.FlowID] > 0 {
+				lossRate = float64(missing) / float64(sent[flow.FlowID])
+			}
+			fmt.Fprintf(w, "%6d %10d %10d %10d %9.2f%% %8d %12v %12v %12v %14s\n",
+				flow.FlowID, sent[flow.FlowID], flow.Received, missing, lossRate*100, flow.Reordered,
+				time.Duration(flow.Latency.P50Ns), time.Duration(flow.Latency.P99Ns),
+				time.Duration(flow.Jitter.MeanNs), FormatBitrate(flow.GoodputBps))
+			continue
+		}
+		fmt.Fprintf(w, "%6d %10d %10d %9.2f%% %8d %12v %12v %12v %14s\n",
+			flow.FlowID, flow.Received, flow.Lost, flow.LossRate*100, flow.Reordered,
+			time.Duration(flow.Latency.P50Ns), time.Duration(flow.Latency.P99Ns),
+			time.Duration(flow.Jitter.MeanNs), FormatBitrate(flow.GoodputBps))
+	}
+	fmt.Fprintf(w, "================\n\n")
+}
+
+// clientFlow 客户端的一个发送流及其发送统计
+type clientFlow struct {
+	Spec  FlowSpec
+	Stats ClientStats
+}
+
+// flowsEnabled 是否以多个并发流发送
+func (c *Client) flowsEnabled() bool {
+	return len(c.flows) > 0
+}
+
+// echoStats 返回回显数据报所属流的发送统计，头部无效或流ID未知时归入默认统计
+func (c *Client) echoStats(data []byte) *ClientStats {
+	header, err := ParseHeader(data)
+	if err != nil {
+		return &c.stats
+	}
+	for _, flow := range c.flows {
+		if flow.Spec.ID == header.FlowID {
+			return &flow.Stats
+		}
+	}
+	return &c.stats
+}
+
+// sendFlows 每个流在独立的协程中按各自的速率和大小发送，直到持续时间结束
+func (c *Client) sendFlows() {
+	c.logf("开始发送 %d 个并发流，持续时间: %v\n", len(c.flows), c.config.Duration)
+	for _, flow := range c.flows {
+		c.logf("  流 %d: %d pps, %d 字节, 负载 %s\n",
+			flow.Spec.ID, flow.Spec.Rate, flow.Spec.Size, flow.Spec.PayloadType)
+	}
+
+	var wg sync.WaitGroup
+	for _, flow := range c.flows {
+		wg.Add(1)
+		go func(flow *clientFlow) {
+			defer wg.Done()
+			runSender(context.Background(), c.conn, SendSpec{
+				Rate:        flow.Spec.Rate,
+				Size:        flow.Spec.Size,
+				Duration:    c.config.Duration,
+				PayloadType: flow.Spec.PayloadType,
+				FlowID:      flow.Spec.ID,
+				Flags:       c.headerFlags(),
+				TrackEcho:   c.config.Echo,
+				Out:         c.out,
+			}, &flow.Stats)
+		}(flow)
+	}
+	wg.Wait()
+}
+
+// flowSent 返回各流成功发送的包数
+func (c *Client) flowSent() map[uint32]int64 {
+	sent := make(map[uint32]int64, len(c.flows))
+	for _, flow := range c.flows {
+		sent[flow.Spec.ID] = flow.Stats.Snapshot(flow.Spec.Size).Sent
+	}
+	return sent
+}
+
+// flowSnapshots 返回各流的发送统计快照
+func (c *Client) flowSnapshots() []ClientFlowSnapshot {
+	var snaps []ClientFlowSnapshot
+	for _, flow := range c.flows {
+		snaps = append(snaps, ClientFlowSnapshot{FlowID: flow.Spec.ID, ClientSnapshot: flow.Stats.Snapshot(flow.Spec.Size)})
+	}
+	return snaps
+}
+
+// snapshot 返回客户端发送统计的快照，多流时合并所有流
+func (c *Client) snapshot() ClientSnapshot {
+	if !c.flowsEnabled() {
+		return c.stats.Snapshot(c.config.PacketSize)
+	}
+
+	total := &ClientStats{}
+	c.mergeStatsInto(total)
+	var parts []ClientSnapshot
+	for _, flow := range c.flowSnapshots() {
+		parts = append(parts, flow.ClientSnapshot)
+	}
+	return mergeClientSnapshots(total, parts)
+}
+
+// mergeStatsInto 将客户端的发送统计（多流时为每个流）累加到 total
+func (c *Client) mergeStatsInto(total *ClientStats) {
+	if !c.flowsEnabled() {
+		total.MergeFrom(&c.stats)
+		return
+	}
+	for _, flow := range c.flows {
+		total.MergeFrom(&flow.Stats)
+	}
+}
+
+// mergeClientSnapshots 由合并后的统计生成汇总快照。
+// 各部分的包大小可能不同，字节数和吞吐取各部分快照之和。
+func mergeClientSnapshots(total *ClientStats, parts []ClientSnapshot) ClientSnapshot {
+	snap := total.Snapshot(0)
+	snap.Bytes, snap.GoodputBps, snap.WireBps = 0, 0, 0
+	for _, part := range parts {
+		snap.Bytes += part.Bytes
+		snap.GoodputBps += part.GoodputBps
+		snap.WireBps += part.WireBps
+	}
+	return snap
+}
+
+// printClientFlows 打印各流的发送统计
+func (c *Client) printClientFlows() {
+	fmt.Fprintf(c.out, "\n=== 客户端各流发送统计 ===\n")
+	fmt.Fprintf(c.out, "%6s %8s %10s %12s %10s %8s %14s %12s %12s\n",
+		"流", "大小", "速率(pps)", "实际(pps)", "发送", "失败", "发送有效吞吐", "RTT p50", "RTT p99")
+	for _, flow := range c.flows {
+		snap := flow.Stats.Snapshot(flow.Spec.Size)
+		rttP50, rttP99 := "-", "-"
+		if snap.RTT != nil {
+			rttP50 = time.Duration(snap.RTT.P50Ns).String()
+			rttP99 = time.Duration(snap.RTT.P99Ns).String()
+		}
+		fmt.Fprintf(c.out, "%6d %8d %10d %12.2f %10d %8d %14s %12s %12s\n",
+			flow.Spec.ID, flow.Spec.Size, flow.Spec.Rate, snap.Rate, snap.Sent, snap.Errors,
+			FormatBitrate(snap.GoodputBps), rttP50, rttP99)
+	}
+
+	total := c.snapshot()
+	fmt.Fprintf(c.out, "合计: 发送 %d, 失败 %d, 发送速率 %.2f pps, 发送有效吞吐 %s\n",
+		total.Sent, total.Errors, total.Rate, FormatBitrate(total.GoodputBps))
+	if c.config.Echo {
+		fmt.Fprintf(c.out, "回显: 收到 %d, 未收到 %d\n", total.EchoReceived, total.EchoLost)
+	}
+	fmt.Fprintf(c.out, "==========================\n")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseFlowSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []FlowSpec
+		wantErr bool
+	}{
+		{"单个流使用默认负载", "1:160:50", []FlowSpec{{ID: 1, Size: 160, Rate: 50, PayloadType: "random"}}, false},
+		{"多个流和负载类型", "1:160:50:constant,2:1200:500", []FlowSpec{
+			{ID: 1, Size: 160, Rate: 50, PayloadType: "constant"},
+			{ID: 2, Size: 1200, Rate: 500, PayloadType: "random"},
+		}, false},
+		{"空白和空项", " 0 : 64 : 10 : sequential , ", []FlowSpec{{ID: 0, Size: 64, Rate: 10, PayloadType: "sequential"}}, false},
+		{"头部长度的包", "3:32:1", []FlowSpec{{ID: 3, Size: HeaderLen, Rate: 1, PayloadType: "random"}}, false},
+		{"最大长度的包", "4:65567:1", []FlowSpec{{ID: 4, Size: MaxPacketSize, Rate: 1, PayloadType: "random"}}, false},
+		{"空字符串", "", nil, true},
+		{"字段过少", "1:160", nil, true},
+		{"字段过多", "1:160:50:random:x", nil, true},
+		{"流ID非数字", "a:160:50", nil, true},
+		{"流ID超出32位", "4294967296:160:50", nil, true},
+		{"包大小小于头部", "1:31:50", nil, true},
+		{"包大小超出负载长度字段", "1:65568:50", nil, true},
+		{"速率为零", "1:160:0", nil, true},
+		{"未知负载类型", "1:160:50:zeros", nil, true},
+		{"流ID重复", "1:160:50,1:200:10", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFlowSpecs(tt.input, "random")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFlowSpecs(%q) err = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseFlowSpecs(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowSetProcessPacket(t *testing.T) {
+	flows := NewFlowSet(0)
+
+	flows.ProcessPacket(testPacket(1, 1), io.Discard, false)
+	flows.ProcessPacket(testPacket(2, 1), io.Discard, false)
+	flows.ProcessPacket(testPacket(1, 2), io.Discard, false)
+
+	malformed := testPacket(100, 1)
+	malformed[2] = HeaderVersion + 1
+	flows.ProcessPacket(malformed, io.Discard, false)
+	corrupted := testPacket(101, 1)
+	corrupted[len(corrupted)-1] ^= 0xff
+	flows.ProcessPacket(corrupted, io.Discard, false)
+
+	if ids := flows.IDs(); !slices.Equal(ids, []uint32{1, 2}) {
+		t.Fatalf("IDs() = %v, want [1 2]，未通过校验的数据报不应创建流", ids)
+	}
+	if got := flows.Flow(1).ReceivedCount; got != 2 {
+		t.Errorf("流1 ReceivedCount = %d, want 2", got)
+	}
+	invalid := flows.Invalid()
+	if invalid.MalformedCount != 1 || invalid.CorruptedCount != 1 {
+		t.Errorf("invalid 畸形 %d, 损坏 %d, want 1, 1", invalid.MalformedCount, invalid.CorruptedCount)
+	}
+	total := flows.Total()
+	if total.ReceivedCount != 3 || total.MalformedCount != 1 || total.CorruptedCount != 1 {
+		t.Errorf("Total() 接收 %d, 畸形 %d, 损坏 %d, want 3, 1, 1",
+			total.ReceivedCount, total.MalformedCount, total.CorruptedCount)
+	}
+}
+
+func TestFlowSetLimit(t *testing.T) {
+	flows := NewFlowSet(0)
+	const extra = 10
+	for id := range uint32(maxFlows + extra) {
+		flows.ProcessPacket(testPacket(id, 1), io.Discard, false)
+	}
+	// 已有的流不受上限影响
+	flows.ProcessPacket(testPacket(0, 2), io.Discard, false)
+
+	if got := flows.Len(); got != maxFlows {
+		t.Errorf("Len() = %d, want %d", got, maxFlows)
+	}
+	if got := flows.Invalid().UntrackedCount; got != extra {
+		t.Errorf("UntrackedCount = %d, want %d", got, extra)
+	}
+	if got := flows.Flow(0).ReceivedCount; got != 2 {
+		t.Errorf("流0 ReceivedCount = %d, want 2", got)
+	}
+}
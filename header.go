@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// 每个数据报（测试数据、回显、下行和控制消息）都以固定的32字节头部开始，大端序：
+//
+//	[0:2]   魔数 0x5144 ("QD")
+//	[2]     版本
+//	[3]     标志位
+//	[4:8]   流ID
+//	[8:16]  序列号
+//	[16:24] 发送时间戳（Unix纳秒）
+//	[24:26] 负载长度（头部之后的字节数）
+//	[26]    负载类型，接收方据此重新生成负载并逐字节比对，0表示不校验负载
+//	[27]    保留，发送方置0，接收方忽略
+//	[28:32] CRC32C校验和，仅在设置 FlagChecksum 时有效，计算时该字段按0处理
+//
+// 接收方忽略不认识的标志位和保留字段，因此新增可选功能不需要提升版本；
+// 只有改变上述布局时才提升版本，旧版本接收方会把这些数据报计为畸形而不是误解析。
+const (
+	HeaderMagic   uint16 = 0x5144
+	HeaderVersion byte   = 1
+	HeaderLen            = 32
+	// MaxPacketSize 测试数据报的最大长度，负载长度字段为2字节
+	MaxPacketSize = HeaderLen + 0xFFFF
+)
+
+// 头部标志位
+const (
+	FlagChecksum byte = 1 << iota // 头部携带整个数据报的CRC32C校验和
+	FlagDownlink                  // 服务端发起的下行数据报
+	FlagControl                   // 控制消息，负载为消息类型和JSON消息体
+)
+
+// 头部校验失败的原因
+var (
+	ErrTruncated          = errors.New("数据报短于头部长度")
+	ErrBadMagic           = errors.New("魔数不匹配")
+	ErrUnsupportedVersion = errors.New("不支持的头部版本")
+	ErrLengthMismatch     = errors.New("负载长度与数据报长度不符")
+	ErrChecksum           = errors.New("校验和不匹配")
+	ErrPayloadMismatch    = errors.New("负载内容与预期不符")
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Header 数据报头部
+type Header struct {
+	Version     byte
+	Flags       byte
+	FlowID      uint32
+	Seq         uint64
+	Timestamp   int64 // Unix纳秒
+	PayloadLen  uint16
+	PayloadType byte
+	Checksum    uint32
+}
+
+// Encode 将头部写入 buf 的前 HeaderLen 字节，版本固定为当前版本，不计算校验和
+func (h *Header) Encode(buf []byte) {
+	binary.BigEndian.PutUint16(buf[0:2], HeaderMagic)
+	buf[2] = HeaderVersion
+	buf[3] = h.Flags
+	binary.BigEndian.PutUint32(buf[4:8], h.FlowID)
+	binary.BigEndian.PutUint64(buf[8:16], h.Seq)
+	binary.BigEndian.PutUint64(buf[16:24], uint64(h.Timestamp))
+	binary.BigEndian.PutUint16(buf[24:26], h.PayloadLen)
+	buf[26] = h.PayloadType
+	buf[27] = 0
+	binary.BigEndian.PutUint32(buf[28:32], 0)
+}
+
+// datagramChecksum 计算整个数据报的CRC32C，校验和字段按0处理
+func datagramChecksum(data []byte) uint32 {
+	var zero [4]byte
+	sum := crc32.Update(0, crc32cTable, data[:28])
+	sum = crc32.Update(sum, crc32cTable, zero[:])
+	return crc32.Update(sum, crc32cTable, data[HeaderLen:])
+}
+
+// SealDatagram 在设置了 FlagChecksum 的数据报中填入校验和，负载写完后调用
+func SealDatagram(data []byte) {
+	if data[3]&FlagChecksum != 0 {
+		binary.BigEndian.PutUint32(data[28:32], datagramChecksum(data))
+	}
+}
+
+// ParseHeader 解析并校验数据报头部：魔数、版本、负载长度，以及设置了 FlagChecksum 时的校验和
+func ParseHeader(data []byte) (Header, error) {
+	if len(data) < HeaderLen {
+		return Header{}, fmt.Errorf("%w: %d 字节", ErrTruncated, len(data))
+	}
+	if magic := binary.BigEndian.Uint16(data[0:2]); magic != HeaderMagic {
+		return Header{}, fmt.Errorf("%w: 0x%04x", ErrBadMagic, magic)
+	}
+
+	h := Header{
+		Version:     data[2],
+		Flags:       data[3],
+		FlowID:      binary.BigEndian.Uint32(data[4:8]),
+		Seq:         binary.BigEndian.Uint64(data[8:16]),
+		Timestamp:   int64(binary.BigEndian.Uint64(data[16:24])),
+		PayloadLen:  binary.BigEndian.Uint16(data[24:26]),
+		PayloadType: data[26],
+		Checksum:    binary.BigEndian.Uint32(data[28:32]),
+	}
+	if h.Version != HeaderVersion {
+		return h, fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+	}
+	if int(h.PayloadLen) != len(data)-HeaderLen {
+		return h, fmt.Errorf("%w: 头部 %d, 实际 %d", ErrLengthMismatch, h.PayloadLen, len(data)-HeaderLen)
+	}
+	if h.Flags&FlagChecksum != 0 && datagramChecksum(data) != h.Checksum {
+		return h, ErrChecksum
+	}
+	return h, nil
+}
+
+// hasFlag 判断数据报是否带有合法魔数并设置了指定标志位，用于在完整校验前分流
+func hasFlag(data []byte, flag byte) bool {
+	return len(data) >= HeaderLen &&
+		binary.BigEndian.Uint16(data[0:2]) == HeaderMagic &&
+		data[3]&flag != 0
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// sealedPacket 生成带校验和的测试数据报
+func sealedPacket(size int) []byte {
+	return GeneratePayload(Header{Flags: FlagChecksum, FlowID: 9, Seq: 42}, size, "sequential")
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	want := Header{
+		Version:     HeaderVersion,
+		Flags:       FlagDownlink | FlagChecksum,
+		FlowID:      0xdeadbeef,
+		Seq:         1<<40 + 7,
+		Timestamp:   -12345,
+		PayloadLen:  100,
+		PayloadType: payloadRandom,
+	}
+	data := make([]byte, HeaderLen+100)
+	want.Encode(data)
+	SealDatagram(data)
+	want.Checksum = datagramChecksum(data)
+
+	got, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("ParseHeader = %+v, want %+v", got, want)
+	}
+}
+
+func TestHeaderEncodeIgnoresVersionAndReserved(t *testing.T) {
+	data := make([]byte, HeaderLen)
+	for i := range data {
+		data[i] = 0xff
+	}
+	(&Header{Version: 9}).Encode(data)
+	if data[2] != HeaderVersion {
+		t.Errorf("版本 = %d, want %d", data[2], HeaderVersion)
+	}
+	if data[27] != 0 {
+		t.Errorf("保留字节 = %d, want 0", data[27])
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    func() []byte
+		wantErr error
+	}{
+		{"合法数据报", func() []byte { return sealedPacket(64) }, nil},
+		{"只有头部", func() []byte { return sealedPacket(HeaderLen) }, nil},
+		{"空数据", func() []byte { return nil }, ErrTruncated},
+		{"短于头部", func() []byte { return sealedPacket(64)[:HeaderLen-1] }, ErrTruncated},
+		{"魔数错误", func() []byte {
+			data := sealedPacket(64)
+			data[1] ^= 0x01
+			return data
+		}, ErrBadMagic},
+		{"版本错误", func() []byte {
+			data := sealedPacket(64)
+			data[2] = HeaderVersion + 1
+			return data
+		}, ErrUnsupportedVersion},
+		{"数据报被截断", func() []byte { return sealedPacket(64)[:60] }, ErrLengthMismatch},
+		{"数据报多出字节", func() []byte { return append(sealedPacket(64), 0) }, ErrLengthMismatch},
+		{"负载被修改", func() []byte {
+			data := sealedPacket(64)
+			data[40] ^= 0x10
+			return data
+		}, ErrChecksum},
+		{"头部被修改", func() []byte {
+			data := sealedPacket(64)
+			data[10] ^= 0x10
+			return data
+		}, ErrChecksum},
+		{"校验和字段被修改", func() []byte {
+			data := sealedPacket(64)
+			data[31] ^= 0x01
+			return data
+		}, ErrChecksum},
+		{"未设置校验和标志时不校验", func() []byte {
+			data := GeneratePayload(Header{Seq: 1}, 64, "sequential")
+			data[31] ^= 0x01
+			return data
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseHeader(tt.data())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseHeader err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHasFlag(t *testing.T) {
+	data := GeneratePayload(Header{Flags: FlagControl}, HeaderLen, "constant")
+	if !hasFlag(data, FlagControl) {
+		t.Error("hasFlag(FlagControl) = false")
+	}
+	if hasFlag(data, FlagDownlink) {
+		t.Error("hasFlag(FlagDownlink) = true")
+	}
+	data[0] = 0
+	if hasFlag(data, FlagControl) {
+		t.Error("魔数错误时 hasFlag 应返回 false")
+	}
+	if hasFlag(data[:HeaderLen-1], FlagControl) {
+		t.Error("短于头部时 hasFlag 应返回 false")
+	}
+}
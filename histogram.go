@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// 直方图采用HDR风格的对数-线性分桶：每个2的幂区间再等分为32个子桶，
+// 相对误差约3%，内存占用固定，与样本数量无关。
+const (
+	histSubBucketBits  = 5
+	histSubBucketCount = 1 << histSubBucketBits
+	histMaxMagnitude   = 42 // 可记录的最大值约 2^42 纳秒 (约73分钟)
+	histBucketCount    = histSubBucketCount + (histMaxMagnitude-histSubBucketBits)*histSubBucketCount
+	histMaxValue       = 1<<histMaxMagnitude - 1
+
+	// 文本渲染时每个2的幂区间显示的行数
+	histRowsPerMagnitude = 4
+	histBarWidth         = 40
+)
+
+// LatencyHistogram 延迟直方图，非并发安全，由调用方加锁
+type LatencyHistogram struct {
+	counts []uint64
+	total  uint64
+	min    uint64
+	max    uint64
+}
+
+func histBucketIndex(v uint64) int {
+	if v < histSubBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 1 - histSubBucketBits
+	sub := int(v>>uint(shift)) - histSubBucketCount
+	return histSubBucketCount + shift*histSubBucketCount + sub
+}
+
+// histBucketBounds 返回桶覆盖的闭区间 [lower, upper]
+func histBucketBounds(index int) (lower, upper uint64) {
+	if index < histSubBucketCount {
+		return uint64(index), uint64(index)
+	}
+	shift := (index - histSubBucketCount) / histSubBucketCount
+	sub := (index - histSubBucketCount) % histSubBucketCount
+	lower = uint64(histSubBucketCount+sub) << uint(shift)
+	return lower, lower + 1<<uint(shift) - 1
+}
+
+// Record 记录一个延迟样本，负值按0处理，超出范围的值被截断到最大值
+func (h *LatencyHistogram) Record(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, histBucketCount)
+	}
+
+	v := uint64(0)
+	if d > 0 {
+		v = uint64(d)
+	}
+	if v > histMaxValue {
+		v = histMaxValue
+	}
+
+	h.counts[histBucketIndex(v)]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+}
+
+// Merge 将另一个直方图的样本累加进来
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	if other.total == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make([]uint64, histBucketCount)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+}
+
+// Count 返回样本总数
+func (h *LatencyHistogram) Count() uint64 {
+	return h.total
+}
+
+// Percentile 返回第p百分位 (0-100) 的延迟，取所在桶的上边界并限制在观测到的最小/最大值之间
+func (h *LatencyHistogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	// 排名向上取整，样本较少时不低估百分位
+	rank := uint64(math.Ceil(p * float64(h.total) / 100))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > h.total {
+		rank = h.total
+	}
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			_, upper := histBucketBounds(i)
+			upper++
+			if upper > h.max {
+				upper = h.max
+			}
+			if upper < h.min {
+				upper = h.min
+			}
+			return time.Duration(upper)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// CumulativeCounts 返回不超过各上界的累计样本数，bounds 需按升序排列。
+// 桶的上边界超过 bound 的样本不计入，因此结果是偏保守的近似值。
+func (h *LatencyHistogram) CumulativeCounts(bounds []time.Duration) []uint64 {
+	result := make([]uint64, len(bounds))
+	if h.total == 0 {
+		return result
+	}
+
+	var seen uint64
+	b := 0
+	for i, c := range h.counts {
+		_, upper := histBucketBounds(i)
+		for b < len(bounds) && time.Duration(upper) > bounds[b] {
+			result[b] = seen
+			b++
+		}
+		if b == len(bounds) {
+			break
+		}
+		seen += c
+	}
+	for ; b < len(bounds); b++ {
+		result[b] = seen
+	}
+	return result
+}
+
+// Render 将直方图渲染为文本，每个2的幂区间分为若干行，便于观察双峰等分布形态
+func (h *LatencyHistogram) Render() string {
+	if h.total == 0 {
+		return ""
+	}
+
+	type row struct {
+		lower, upper uint64
+		count        uint64
+	}
+
+	// 合并子桶为显示行，小于子桶数的精确桶合并为一行
+	var rows []row
+	var cur row
+	curGroup := -1
+	for i, c := range h.counts {
+		lower, upper := histBucketBounds(i)
+		group := 0
+		if i >= histSubBucketCount {
+			group = 1 + (i-histSubBucketCount)/(histSubBucketCount/histRowsPerMagnitude)
+		}
+		if group != curGroup {
+			if curGroup >= 0 {
+				rows = append(rows, cur)
+			}
+			cur = row{lower: lower}
+			curGroup = group
+		}
+		cur.upper = upper
+		cur.count += c
+	}
+	rows = append(rows, cur)
+
+	// 去掉首尾的空行
+	first, last := 0, len(rows)-1
+	for first < last && rows[first].count == 0 {
+		first++
+	}
+	for last > first && rows[last].count == 0 {
+		last--
+	}
+	rows = rows[first : last+1]
+
+	var maxCount uint64
+	for _, r := range rows {
+		if r.count > maxCount {
+			maxCount = r.count
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range rows {
+		barLen := int(r.count * histBarWidth / maxCount)
+		if r.count > 0 && barLen == 0 {
+			barLen = 1
+		}
+		fmt.Fprintf(&b, "%12v - %-12v |%-*s| %d (%.2f%%)\n",
+			time.Duration(r.lower), time.Duration(r.upper+1), histBarWidth,
+			strings.Repeat("#", barLen), r.count, float64(r.count)/float64(h.total)*100)
+	}
+	return b.String()
+}
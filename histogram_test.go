@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// withinBucket 检查直方图返回值不低于期望值，且不超过一个子桶的相对误差
+func withinBucket(got, want time.Duration) bool {
+	return got >= want && got <= want+want/histSubBucketCount+1
+}
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	var hundred []time.Duration
+	for i := 1; i <= 100; i++ {
+		hundred = append(hundred, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		p       float64
+		want    time.Duration
+	}{
+		{"空直方图", nil, 50, 0},
+		{"单个样本", []time.Duration{5 * time.Millisecond}, 99, 5 * time.Millisecond},
+		{"三个样本的p50向上取整", []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}, 50, 20 * time.Millisecond},
+		{"三个样本的p99", []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}, 99, 30 * time.Millisecond},
+		{"p0取最小值所在桶", hundred, 0, time.Millisecond},
+		{"p50", hundred, 50, 50 * time.Millisecond},
+		{"p90", hundred, 90, 90 * time.Millisecond},
+		{"p99", hundred, 99, 99 * time.Millisecond},
+		{"p99.9", hundred, 99.9, 100 * time.Millisecond},
+		{"p100限制在最大值", hundred, 100, 100 * time.Millisecond},
+		{"负值按0处理", []time.Duration{-time.Millisecond}, 50, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h LatencyHistogram
+			for _, d := range tt.samples {
+				h.Record(d)
+			}
+			if got := h.Percentile(tt.p); !withinBucket(got, tt.want) {
+				t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyHistogramMerge(t *testing.T) {
+	var a, b LatencyHistogram
+	for i := 1; i <= 50; i++ {
+		a.Record(time.Duration(i) * time.Millisecond)
+		b.Record(time.Duration(50+i) * time.Millisecond)
+	}
+	var empty LatencyHistogram
+	a.Merge(&empty)
+	a.Merge(&b)
+
+	if a.Count() != 100 {
+		t.Fatalf("Count() = %d, want 100", a.Count())
+	}
+	if got := a.Percentile(0); !withinBucket(got, time.Millisecond) {
+		t.Errorf("合并后的最小值 = %v, want 1ms", got)
+	}
+	if got := a.Percentile(100); got != 100*time.Millisecond {
+		t.Errorf("合并后的最大值 = %v, want 100ms", got)
+	}
+	if got := a.Percentile(75); !withinBucket(got, 75*time.Millisecond) {
+		t.Errorf("合并后的p75 = %v, want 75ms", got)
+	}
+}
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	for _, v := range []uint64{0, 1, 31, 32, 33, 63, 64, 1000, 123456789, histMaxValue} {
+		lower, upper := histBucketBounds(histBucketIndex(v))
+		if v < lower || v > upper {
+			t.Errorf("值 %d 落在桶 [%d, %d] 之外", v, lower, upper)
+		}
+		if upper-lower > lower/histSubBucketCount {
+			t.Errorf("值 %d 所在桶 [%d, %d] 超过一个子桶的宽度", v, lower, upper)
+		}
+	}
+	if got := histBucketIndex(histMaxValue); got != histBucketCount-1 {
+		t.Errorf("最大值的桶序号 = %d, want %d", got, histBucketCount-1)
+	}
+}
+
+func TestLatencyHistogramCumulativeCounts(t *testing.T) {
+	var h LatencyHistogram
+	for i := 1; i <= 10; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	bounds := []time.Duration{500 * time.Microsecond, 5*time.Millisecond + 200*time.Microsecond, time.Second}
+	want := []uint64{0, 5, 10}
+	got := h.CumulativeCounts(bounds)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("CumulativeCounts(%v) = %d, want %d", bounds[i], got[i], want[i])
+		}
+	}
+}
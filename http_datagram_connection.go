@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+const (
+	// connectUDPProtocol 扩展CONNECT请求的 :protocol（RFC 9298）
+	connectUDPProtocol = "connect-udp"
+	// h3DatagramPath 测试服务端直接终结HTTP数据报的请求路径
+	h3DatagramPath = "/quic-datagram-test/h3"
+	// httpDatagramPrefix 每个HTTP数据报在测试数据报前的开销：
+	// 1字节的quarter stream ID（请求流ID很小）和1字节的Context ID 0
+	httpDatagramPrefix = 2
+)
+
+// httpDatagramStream 客户端的 *http3.RequestStream 和服务端的 *http3.Stream 共有的方法
+type httpDatagramStream interface {
+	io.ReadCloser
+	SendDatagram(b []byte) error
+	ReceiveDatagram(ctx context.Context) ([]byte, error)
+}
+
+// HTTPDatagramConnection 在一个HTTP/3扩展CONNECT请求流上以HTTP数据报（RFC 9297）收发测试数据报，
+// 数据报格式与CONNECT-UDP（RFC 9298）相同：Context ID 0 加UDP负载。
+// 直接连接测试服务端时由服务端终结请求；经过MASQUE代理时代理把负载转发到目标UDP地址。
+// 请求流本身不能承载其他流，因此没有可靠流。
+type HTTPDatagramConnection struct {
+	stream  httpDatagramStream
+	remote  string
+	conn    *quic.Conn // 客户端使用
+	onClose func()     // 客户端启动的本地代理在连接关闭时停止
+}
+
+// newHTTPDatagramConnection 包装已建立的请求流，并在后台读取流上的数据（capsule），
+// 使对端关闭请求流或连接时 ReceiveDatagram 返回错误
+func newHTTPDatagramConnection(stream httpDatagramStream, remote string) *HTTPDatagramConnection {
+	go io.Copy(io.Discard, stream)
+	return &HTTPDatagramConnection{stream: stream, remote: remote}
+}
+
+// dialHTTPDatagram 连接 addr 上的HTTP/3服务端，以扩展CONNECT请求 path 建立CONNECT-UDP请求流
+func dialHTTPDatagram(ctx context.Context, addr, path string) (*HTTPDatagramConnection, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http3.NextProtoH3},
+	}
+	conn, err := quic.DialAddr(ctx, addr, tlsConfig, &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := openConnectUDP(ctx, conn, addr, path)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+	c := newHTTPDatagramConnection(stream, conn.RemoteAddr().String())
+	c.conn = conn
+	return c, nil
+}
+
+// openConnectUDP 在已建立的QUIC连接上发送CONNECT-UDP请求并等待2xx响应
+func openConnectUDP(ctx context.Context, conn *quic.Conn, addr, path string) (*http3.RequestStream, error) {
+	transport := &http3.Transport{EnableDatagrams: true}
+	clientConn := transport.NewClientConn(conn)
+	select {
+	case <-clientConn.ReceivedSettings():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	settings := clientConn.Settings()
+	if !settings.EnableExtendedConnect || !settings.EnableDatagrams {
+		return nil, errors.New("服务端未启用扩展CONNECT或HTTP数据报")
+	}
+
+	u, err := url.Parse("https://" + addr + path)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := clientConn.OpenRequestStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("打开请求流失败: %w", err)
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		Proto:  connectUDPProtocol,
+		Host:   u.Host,
+		URL:    u,
+		Header: http.Header{"Capsule-Protocol": []string{"?1"}},
+	}
+	if err := stream.SendRequestHeader(req); err != nil {
+		return nil, fmt.Errorf("发送CONNECT-UDP请求失败: %w", err)
+	}
+	resp, err := stream.ReadResponse()
+	if err != nil {
+		return nil, fmt.Errorf("读取CONNECT-UDP响应失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("CONNECT-UDP请求被拒绝: HTTP %d", resp.StatusCode)
+	}
+	return stream, nil
+}
+
+// acceptConnectUDP 校验扩展CONNECT请求并返回2xx，之后由调用者接管请求流
+func acceptConnectUDP(w http.ResponseWriter, r *http.Request) (*http3.Stream, bool) {
+	if r.Method != http.MethodConnect || r.Proto != connectUDPProtocol {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	w.Header().Set("Capsule-Protocol", "?1")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	return w.(http3.HTTPStreamer).HTTPStream(), true
+}
+
+// serveHTTPDatagram 作为CONNECT-UDP的终点接受请求，请求流上的HTTP数据报作为测试数据报处理
+func (s *Server) serveHTTPDatagram(w http.ResponseWriter, r *http.Request) {
+	stream, ok := acceptConnectUDP(w, r)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+	s.handleConnection(newHTTPDatagramConnection(stream, r.RemoteAddr))
+}
+
+// encodeUDPPayload 在负载前加上Context ID 0
+func encodeUDPPayload(data []byte) []byte {
+	msg := make([]byte, 1+len(data))
+	copy(msg[1:], data)
+	return msg
+}
+
+// decodeUDPPayload 去掉Context ID，Context ID不为0的数据报（未知扩展）返回false
+func decodeUDPPayload(data []byte) ([]byte, bool) {
+	contextID, n, err := quicvarint.Parse(data)
+	if err != nil || contextID != 0 {
+		return nil, false
+	}
+	return data[n:], true
+}
+
+func (c *HTTPDatagramConnection) SendDatagram(data []byte) error {
+	err := c.stream.SendDatagram(encodeUDPPayload(data))
+	// quic-go报告的上限包含quarter stream ID和Context ID，换算为可用的负载长度
+	var tooLarge *quic.DatagramTooLargeError
+	if errors.As(err, &tooLarge) {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: tooLarge.MaxDatagramPayloadSize - httpDatagramPrefix}
+	}
+	return err
+}
+
+func (c *HTTPDatagramConnection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	for {
+		data, err := c.stream.ReceiveDatagram(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if payload, ok := decodeUDPPayload(data); ok {
+			return payload, nil
+		}
+	}
+}
+
+func (c *HTTPDatagramConnection) OpenStream(ctx context.Context) (Stream, error) {
+	return nil, errStreamsUnsupported
+}
+
+func (c *HTTPDatagramConnection) AcceptStream(ctx context.Context) (Stream, error) {
+	return nil, errStreamsUnsupported
+}
+
+// Close 客户端关闭底层连接；服务端关闭请求流的发送方向
+func (c *HTTPDatagramConnection) Close() error {
+	var err error
+	if c.conn != nil {
+		err = c.conn.CloseWithError(0, "")
+	} else {
+		err = c.stream.Close()
+	}
+	if c.onClose != nil {
+		c.onClose()
+	}
+	return err
+}
+
+func (c *HTTPDatagramConnection) RemoteAddr() string {
+	return c.remote
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// jitterSampleInterval 抖动时间序列的采样间隔
+	jitterSampleInterval = time.Second
+	// jitterMaxSamples 时间序列保留的最大采样点数，超出后丢弃最旧的
+	jitterMaxSamples = 3600
+)
+
+// JitterSample 抖动时间序列中的一个采样点
+type JitterSample struct {
+	Time   time.Time
+	Jitter time.Duration
+}
+
+// JitterTracker 按RFC 3550 (A.8) 计算到达间隔抖动，非并发安全，由调用方加锁
+type JitterTracker struct {
+	jitter      float64 // 当前抖动估计值（纳秒）
+	sum         float64 // 每次更新后抖动值之和，用于计算平均值
+	updates     int64
+	max         float64
+	prevTransit time.Duration
+	hasPrev     bool
+
+	series     []JitterSample
+	lastSample time.Time
+}
+
+// Update 用发送时间戳和到达时间更新抖动估计。
+// 两端时钟的固定偏差在相邻包的传输时间差中被抵消，因此不要求时钟同步。
+func (j *JitterTracker) Update(sendTime, arrival time.Time) {
+	transit := arrival.Sub(sendTime)
+	if !j.hasPrev {
+		j.prevTransit = transit
+		j.hasPrev = true
+		j.lastSample = arrival
+		return
+	}
+
+	d := transit - j.prevTransit
+	j.prevTransit = transit
+	if d < 0 {
+		d = -d
+	}
+
+	// J(i) = J(i-1) + (|D(i-1,i)| - J(i-1))/16
+	j.jitter += (float64(d) - j.jitter) / 16
+	j.sum += j.jitter
+	j.updates++
+	if j.jitter > j.max {
+		j.max = j.jitter
+	}
+
+	if arrival.Sub(j.lastSample) >= jitterSampleInterval {
+		j.lastSample = arrival
+		j.series = append(j.series, JitterSample{Time: arrival, Jitter: j.Current()})
+		if len(j.series) > jitterMaxSamples {
+			j.series = j.series[len(j.series)-jitterMaxSamples:]
+		}
+	}
+}
+
+// Current 返回当前抖动
+func (j *JitterTracker) Current() time.Duration {
+	return time.Duration(j.jitter)
+}
+
+// Mean 返回整个测试期间抖动的平均值
+func (j *JitterTracker) Mean() time.Duration {
+	if j.updates == 0 {
+		return 0
+	}
+	return time.Duration(j.sum / float64(j.updates))
+}
+
+// Max 返回观测到的最大抖动
+func (j *JitterTracker) Max() time.Duration {
+	return time.Duration(j.max)
+}
+
+// Series 返回抖动时间序列
+func (j *JitterTracker) Series() []JitterSample {
+	return j.series
+}
+
+// Merge 合并另一个会话的抖动统计用于汇总视图：平均值按更新次数加权，
+// 当前值和最大值取较大者，时间序列不合并
+func (j *JitterTracker) Merge(other *JitterTracker) {
+	j.sum += other.sum
+	j.updates += other.updates
+	if other.jitter > j.jitter {
+		j.jitter = other.jitter
+	}
+	if other.max > j.max {
+		j.max = other.max
+	}
+}
+
+// RenderSeries 将时间序列渲染为一行，最多显示最近 limit 个采样点
+func (j *JitterTracker) RenderSeries(limit int) string {
+	series := j.series
+	if len(series) > limit {
+		series = series[len(series)-limit:]
+	}
+
+	parts := make([]string, len(series))
+	for i, sample := range series {
+		parts[i] = sample.Jitter.Round(time.Microsecond).String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// String 格式化当前/平均/最大抖动
+func (j *JitterTracker) String() string {
+	return fmt.Sprintf("当前=%v 平均=%v 最大=%v", j.Current(), j.Mean(), j.Max())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		transits []time.Duration // 每个包的传输时间，发送间隔固定为20ms
+		offset   time.Duration   // 两端时钟的固定偏差
+		current  time.Duration
+		max      time.Duration
+	}{
+		{"单个包不更新", []time.Duration{5 * time.Millisecond}, 0, 0, 0},
+		{"传输时间不变", []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond}, 0, 0, 0},
+		// J = 0 + (16ms - 0)/16
+		{"一次变化", []time.Duration{5 * time.Millisecond, 21 * time.Millisecond}, 0, time.Millisecond, time.Millisecond},
+		// J1 = 1ms, J2 = 1ms + (16ms - 1ms)/16
+		{"两次变化", []time.Duration{5 * time.Millisecond, 21 * time.Millisecond, 5 * time.Millisecond}, 0, 1937500 * time.Nanosecond, 1937500 * time.Nanosecond},
+		// J1 = 1ms, J2 = 1ms - 1ms/16
+		{"变化后恢复", []time.Duration{5 * time.Millisecond, 21 * time.Millisecond, 21 * time.Millisecond}, 0, 937500 * time.Nanosecond, time.Millisecond},
+		{"时钟偏差被抵消", []time.Duration{5 * time.Millisecond, 21 * time.Millisecond}, time.Hour, time.Millisecond, time.Millisecond},
+		{"负的时钟偏差", []time.Duration{5 * time.Millisecond, 21 * time.Millisecond}, -time.Hour, time.Millisecond, time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var j JitterTracker
+			start := time.Now()
+			for i, transit := range tt.transits {
+				send := start.Add(time.Duration(i) * 20 * time.Millisecond)
+				j.Update(send.Add(tt.offset), send.Add(transit))
+			}
+			if got := j.Current(); got != tt.current {
+				t.Errorf("Current() = %v, want %v", got, tt.current)
+			}
+			if got := j.Max(); got != tt.max {
+				t.Errorf("Max() = %v, want %v", got, tt.max)
+			}
+		})
+	}
+}
+
+func TestJitterTrackerMerge(t *testing.T) {
+	var a, b JitterTracker
+	start := time.Now()
+	// a: 一次16ms的变化，J=1ms；b: 一次32ms的变化，J=2ms
+	a.Update(start, start.Add(5*time.Millisecond))
+	a.Update(start.Add(20*time.Millisecond), start.Add(41*time.Millisecond))
+	b.Update(start, start.Add(5*time.Millisecond))
+	b.Update(start.Add(20*time.Millisecond), start.Add(57*time.Millisecond))
+
+	a.Merge(&b)
+	if got := a.Mean(); got != 1500*time.Microsecond {
+		t.Errorf("Mean() = %v, want 1.5ms", got)
+	}
+	if got := a.Max(); got != 2*time.Millisecond {
+		t.Errorf("Max() = %v, want 2ms", got)
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"sync"
 
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	tpt "github.com/libp2p/go-libp2p/core/transport"
 	"github.com/quic-go/quic-go"
 )
@@ -51,23 +54,46 @@ func getQuicConn(c tpt.CapableConn) (*quic.Conn, error) {
 	return nil, errors.New("underlying connection does not support quic.Conn")
 }
 
+// controlProtocolID 控制流和批量数据流使用的libp2p协议，两者以流开头的前缀区分
+const controlProtocolID = protocol.ID("/quic-datagram-test/control/1.0.0")
+
+// streamBacklog 每个连接等待服务端接受的流数上限，超出时重置新的流
+const streamBacklog = 16
+
 // LibP2PConnection 包装libp2p连接
 type LibP2PConnection struct {
 	conn     network.Conn
 	dgConn   DatagramConn
 	peerAddr string
+
+	// libp2p的流需要经过host协商协议，由 streamRouter 按连接分发到这里
+	host    host.Host
+	streams chan network.Stream
+	// 客户端为每个连接单独创建host，关闭连接时一并关闭；服务端的host由所有连接共享
+	ownsHost bool
+
+	// 服务端等待测试流量时先读到的数据报，由 ReceiveDatagram 首先返回
+	pending    []byte
+	active     chan struct{} // 收到控制流时关闭
+	activeOnce sync.Once
+	done       chan struct{} // 连接断开时关闭
+	doneOnce   sync.Once
 }
 
-func NewLibP2PConnection(conn network.Conn) (*LibP2PConnection, error) {
+func NewLibP2PConnection(h host.Host, conn network.Conn) (*LibP2PConnection, error) {
 	var dgConn DatagramConn
 	if ok := conn.As(&dgConn); !ok {
 		return nil, errors.New("connection does not support DatagramConn")
 	}
-	
+
 	return &LibP2PConnection{
 		conn:     conn,
 		dgConn:   dgConn,
 		peerAddr: conn.RemotePeer().String(),
+		host:     h,
+		streams:  make(chan network.Stream, streamBacklog),
+		active:   make(chan struct{}),
+		done:     make(chan struct{}),
 	}, nil
 }
 
@@ -76,13 +102,122 @@ func (c *LibP2PConnection) SendDatagram(data []byte) error {
 }
 
 func (c *LibP2PConnection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	if data := c.pending; data != nil {
+		c.pending = nil
+		return data, nil
+	}
 	return c.dgConn.ReceiveDatagram(ctx)
 }
 
+// awaitTraffic 等待连接上出现第一个数据报或控制流，连接在此之前断开时返回false。
+// 连接上还承载DHT查询，只有出现测试流量的连接才作为测试会话处理。
+// 读到的第一个数据报保留给之后的 ReceiveDatagram
+func (c *LibP2PConnection) awaitTraffic() bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := c.dgConn.ReceiveDatagram(ctx)
+		received <- data
+	}()
+
+	select {
+	case data := <-received:
+		cancel()
+		c.pending = data
+		return data != nil
+	case <-c.active:
+	case <-c.done:
+	}
+	cancel()
+	// 取消之前可能已经读到数据报
+	c.pending = <-received
+	return c.isActive()
+}
+
+func (c *LibP2PConnection) isActive() bool {
+	select {
+	case <-c.active:
+		return true
+	default:
+		return c.pending != nil
+	}
+}
+
+func (c *LibP2PConnection) OpenStream(ctx context.Context) (Stream, error) {
+	return c.host.NewStream(ctx, c.conn.RemotePeer(), controlProtocolID)
+}
+
+func (c *LibP2PConnection) AcceptStream(ctx context.Context) (Stream, error) {
+	select {
+	case stream := <-c.streams:
+		return stream, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (c *LibP2PConnection) Close() error {
+	if c.ownsHost {
+		return c.host.Close()
+	}
 	return c.conn.Close()
 }
 
 func (c *LibP2PConnection) RemoteAddr() string {
 	return c.peerAddr
 }
+
+// streamRouter 把服务端收到的控制流交给所属连接。
+// 流可能先于连接通知到达，因此两边都通过 connection 获取同一个 LibP2PConnection。
+type streamRouter struct {
+	host  host.Host
+	mutex sync.Mutex
+	conns map[string]*LibP2PConnection
+}
+
+func newStreamRouter(h host.Host) *streamRouter {
+	r := &streamRouter{host: h, conns: make(map[string]*LibP2PConnection)}
+	h.SetStreamHandler(controlProtocolID, r.handleStream)
+	return r
+}
+
+// connection 返回 conn 对应的 LibP2PConnection，不存在时创建
+func (r *streamRouter) connection(conn network.Conn) (*LibP2PConnection, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if c, ok := r.conns[conn.ID()]; ok {
+		return c, nil
+	}
+	c, err := NewLibP2PConnection(r.host, conn)
+	if err != nil {
+		return nil, err
+	}
+	r.conns[conn.ID()] = c
+	return c, nil
+}
+
+// remove 在连接断开后移除
+func (r *streamRouter) remove(conn network.Conn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if c, ok := r.conns[conn.ID()]; ok {
+		c.doneOnce.Do(func() { close(c.done) })
+	}
+	delete(r.conns, conn.ID())
+}
+
+func (r *streamRouter) handleStream(stream network.Stream) {
+	c, err := r.connection(stream.Conn())
+	if err != nil {
+		stream.Reset()
+		return
+	}
+
+	select {
+	case c.streams <- stream:
+		c.activeOnce.Do(func() { close(c.active) })
+	default:
+		stream.Reset()
+	}
+}
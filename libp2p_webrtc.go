@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	tpt "github.com/libp2p/go-libp2p/core/transport"
+	libp2pwebrtc "github.com/libp2p/go-libp2p/p2p/transport/webrtc"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/pion/datachannel"
+	"github.com/pion/webrtc/v4"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// webrtcDatagramChannelID 承载测试数据报的数据通道ID。两端以相同ID预先协商（negotiated）创建，
+	// 不经过DCEP，因此不会被libp2p当作新的流接受；libp2p的流ID从小到大依次分配，测试中不会用到这个值
+	webrtcDatagramChannelID uint16 = 65534
+	// webrtcMaxMessageSize libp2p webrtc-direct在SDP中声明的 max-message-size
+	webrtcMaxMessageSize = 16384
+	// webrtcSendBuffer 数据通道待发送数据超过该值时等待排空，与quic-go的数据报队列满时阻塞一致
+	webrtcSendBuffer = 1 << 20
+	// webrtcSendWait 等待发送缓冲区排空的最长时间
+	webrtcSendWait = time.Second
+	// webrtcQueueLen 接收队列长度，队列满时丢弃
+	webrtcQueueLen = 1024
+)
+
+var (
+	errWebRTCSendBlocked = errors.New("数据通道发送缓冲区已满")
+	errWebRTCClosed      = errors.New("数据通道已关闭")
+)
+
+// WebRTCDatagramTransport 包装libp2p的webrtc-direct transport，在每个连接上额外打开
+// 无序、不重传的数据通道，返回的连接实现 DatagramConn
+type WebRTCDatagramTransport struct {
+	*libp2pwebrtc.WebRTCTransport
+}
+
+// NewWebRTCDatagramTransport 创建支持datagram的webrtc-direct transport
+func NewWebRTCDatagramTransport(key crypto.PrivKey) (tpt.Transport, error) {
+	listenUDP := func(network string, laddr *net.UDPAddr) (net.PacketConn, error) {
+		return net.ListenUDP(network, laddr)
+	}
+	baseTransport, err := libp2pwebrtc.New(key, nil, nil, nil, listenUDP)
+	if err != nil {
+		return nil, err
+	}
+	return &WebRTCDatagramTransport{WebRTCTransport: baseTransport}, nil
+}
+
+func (t *WebRTCDatagramTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (tpt.CapableConn, error) {
+	c, err := t.WebRTCTransport.Dial(ctx, raddr, p)
+	if err != nil {
+		return nil, err
+	}
+	return newWebRTCDatagramConn(ctx, c)
+}
+
+func (t *WebRTCDatagramTransport) Listen(addr ma.Multiaddr) (tpt.Listener, error) {
+	ln, err := t.WebRTCTransport.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &webrtcDatagramListener{Listener: ln}, nil
+}
+
+// webrtcDatagramListener 在接受的连接交给host之前打开数据报通道，
+// 客户端的第一个数据报在协商控制流之后才发送，此时服务端的通道已经存在
+type webrtcDatagramListener struct {
+	tpt.Listener
+}
+
+func (l *webrtcDatagramListener) Accept() (tpt.CapableConn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		dc, err := newWebRTCDatagramConn(ctx, c)
+		cancel()
+		if err != nil {
+			// 单个连接失败不影响监听
+			continue
+		}
+		return dc, nil
+	}
+}
+
+// webrtcDatagramConn 包装webrtc-direct连接，测试数据报通过预先协商的数据通道收发：
+// 无序（ordered=false）、不重传（maxRetransmits=0），每条消息对应一个数据报
+type webrtcDatagramConn struct {
+	tpt.CapableConn
+	channel  datachannel.ReadWriteCloser
+	dc       *webrtc.DataChannel
+	drained  chan struct{}
+	incoming chan []byte
+	closed   chan struct{}
+}
+
+// newWebRTCDatagramConn 在连接底层的PeerConnection上创建数据报通道并开始接收
+func newWebRTCDatagramConn(ctx context.Context, c tpt.CapableConn) (*webrtcDatagramConn, error) {
+	var pc *webrtc.PeerConnection
+	if !c.As(&pc) {
+		c.Close()
+		return nil, errors.New("连接不是WebRTC连接")
+	}
+
+	negotiated, ordered := true, false
+	id, maxRetransmits := webrtcDatagramChannelID, uint16(0)
+	dc, err := pc.CreateDataChannel("quic-datagram-test", &webrtc.DataChannelInit{
+		Negotiated:     &negotiated,
+		ID:             &id,
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	// libp2p的PeerConnection使用分离（detached）模式，通道打开后才能取得读写接口；
+	// SCTP已经连通时 OnOpen 立即回调
+	opened := make(chan error, 1)
+	var channel datachannel.ReadWriteCloser
+	dc.OnOpen(func() {
+		var err error
+		channel, err = dc.Detach()
+		opened <- err
+	})
+	select {
+	case err = <-opened:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	conn := &webrtcDatagramConn{
+		CapableConn: c,
+		channel:     channel,
+		dc:          dc,
+		drained:     make(chan struct{}, 1),
+		incoming:    make(chan []byte, webrtcQueueLen),
+		closed:      make(chan struct{}),
+	}
+	dc.SetBufferedAmountLowThreshold(webrtcSendBuffer / 2)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case conn.drained <- struct{}{}:
+		default:
+		}
+	})
+	go conn.receive()
+	return conn, nil
+}
+
+// receive 读取数据通道上的消息放入接收队列，通道关闭时结束
+func (c *webrtcDatagramConn) receive() {
+	defer close(c.closed)
+	buf := make([]byte, webrtcMaxMessageSize)
+	for {
+		n, err := c.channel.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case c.incoming <- append([]byte(nil), buf[:n]...):
+		default:
+		}
+	}
+}
+
+func (c *webrtcDatagramConn) SendDatagram(data []byte) error {
+	// 与QUIC一致地返回 DatagramTooLargeError，使尺寸探测对各模式通用
+	if len(data) > webrtcMaxMessageSize {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: webrtcMaxMessageSize}
+	}
+	if c.dc.BufferedAmount() > webrtcSendBuffer {
+		select {
+		case <-c.drained:
+		case <-c.closed:
+			return errWebRTCClosed
+		case <-time.After(webrtcSendWait):
+			return errWebRTCSendBlocked
+		}
+	}
+	_, err := c.channel.Write(data)
+	return err
+}
+
+func (c *webrtcDatagramConn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-c.incoming:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, errWebRTCClosed
+	}
+}
+
+func (c *webrtcDatagramConn) As(target any) bool {
+	if t, ok := target.(*DatagramConn); ok {
+		*t = c
+		return true
+	}
+	return c.CapableConn.As(target)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	tpt "github.com/libp2p/go-libp2p/core/transport"
+	"github.com/quic-go/quic-go"
+)
+
+// newWebRTCTestHost 创建使用webrtc-direct数据报transport的host，listen 为空时只拨号
+func newWebRTCTestHost(t *testing.T, listen ...string) host.Host {
+	t.Helper()
+	key, err := GenerateRandomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := NewWebRTCDatagramTransport(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenAddrs := libp2p.NoListenAddrs
+	if len(listen) > 0 {
+		listenAddrs = libp2p.ListenAddrStrings(listen...)
+	}
+	h, err := libp2p.New(
+		libp2p.Identity(key),
+		libp2p.Transport(func() (tpt.Transport, error) { return transport, nil }),
+		listenAddrs,
+		libp2p.DisableRelay(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// TestWebRTCDatagramChannel 两端经预先协商的数据通道互发数据报
+func TestWebRTCDatagramChannel(t *testing.T) {
+	server := newWebRTCTestHost(t, "/ip4/127.0.0.1/udp/0/webrtc-direct")
+	client := newWebRTCTestHost(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	connection := func(h host.Host, remote peer.ID) *LibP2PConnection {
+		t.Helper()
+		conns := h.Network().ConnsToPeer(remote)
+		if len(conns) == 0 {
+			t.Fatal("没有到对端的连接")
+		}
+		conn, err := NewLibP2PConnection(h, conns[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	clientConn := connection(client, server.ID())
+	serverConn := connection(server, client.ID())
+
+	for _, tt := range []struct {
+		name     string
+		from, to *LibP2PConnection
+	}{
+		{"客户端到服务端", clientConn, serverConn},
+		{"服务端到客户端", serverConn, clientConn},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := GeneratePayload(Header{Seq: 1}, 1200, "random")
+			if err := tt.from.SendDatagram(packet); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.to.ReceiveDatagram(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, packet) {
+				t.Error("收到的数据报与发送的不同")
+			}
+		})
+	}
+
+	var tooLarge *quic.DatagramTooLargeError
+	if err := clientConn.SendDatagram(make([]byte, webrtcMaxMessageSize+1)); !errors.As(err, &tooLarge) {
+		t.Errorf("超过 max-message-size 的数据报 err = %v, want DatagramTooLargeError", err)
+	}
+}
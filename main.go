@@ -16,7 +16,7 @@ func main() {
 			isServer = true
 			break
 		}
-		if arg == "-server" || arg == "-peer" {
+		if arg == "-server" || arg == "-peer" || arg == "-discover" || arg == "-discover-list" {
 			isServer = false
 			break
 		}
@@ -46,7 +46,7 @@ func main() {
 		fmt.Println("  go run *.go -mode native -addr 0.0.0.0:4363")
 		fmt.Println("  go run *.go -mode libp2p -listen /ip4/0.0.0.0/udp/4363/quic-v1")
 		fmt.Println()
-		fmt.Println("客户端模式（使用 -server 或 -peer）：")
+		fmt.Println("客户端模式（使用 -server、-peer 或 -discover）：")
 		fmt.Println("  go run *.go -mode native -server localhost:4363")
 		fmt.Println("  go run *.go -mode libp2p -peer /ip4/127.0.0.1/udp/4363/quic-v1/p2p/...")
 		fmt.Println()
@@ -63,7 +63,7 @@ func main() {
 
 func hasServerOrClientFlag() bool {
 	for _, arg := range os.Args[1:] {
-		if arg == "-addr" || arg == "-listen" || arg == "-server" || arg == "-peer" {
+		if arg == "-addr" || arg == "-listen" || arg == "-server" || arg == "-peer" || arg == "-rendezvous" || arg == "-discover" || arg == "-discover-list" {
 			return true
 		}
 	}
@@ -79,33 +79,128 @@ func printHelp() {
 	fmt.Println()
 	fmt.Println("通用选项:")
 	fmt.Println("  -mode string")
-	fmt.Println("        连接模式: native 或 libp2p (默认 \"native\")")
+	fmt.Println("        连接模式: native、stream、webtransport、h3、udp、masque、libp2p 或 libp2p-webrtc (默认 \"native\")")
+	fmt.Println("        stream: 单条QUIC流上带长度前缀的消息代替DATAGRAM帧；udp: 裸UDP数据报，不支持可靠流")
+	fmt.Println("        webtransport: 通过HTTP/3 WebTransport会话的数据报传输，会话路径为 " + webTransportPath)
+	fmt.Println("        h3: HTTP/3扩展CONNECT请求流上的HTTP数据报 (RFC 9297)，不支持可靠流")
+	fmt.Println("        masque: 经CONNECT-UDP代理 (RFC 9298) 连接裸UDP服务端；服务端使用该模式时运行代理")
+	fmt.Println("        libp2p-webrtc: libp2p webrtc-direct连接，数据报通过无序、不重传的数据通道发送")
+	fmt.Println("  -output string")
+	fmt.Println("        输出格式: text 或 json (默认 \"text\")")
+	fmt.Println("        json模式下结果以JSON行写入标准输出，其余信息写入标准错误")
+	fmt.Println("  -output-file string")
+	fmt.Println("        将JSON结果文档和周期快照 (每行一条记录) 写入指定文件")
+	fmt.Println("  -verbose")
+	fmt.Println("        逐包输出收到的数据报 (服务端) 或下行数据报 (客户端)，高速率下输出会成为瓶颈 (默认关闭)")
 	fmt.Println()
-	fmt.Println("服务端选项 (Native模式):")
+	fmt.Println("服务端选项:")
+	fmt.Println("  -echo")
+	fmt.Println("        将收到的数据报回显给客户端，用于往返时延测量")
+	fmt.Println("  -metrics string")
+	fmt.Println("        Prometheus指标HTTP监听地址，例如 :9090，通过 /metrics 访问 (默认不启用)")
+	fmt.Println()
+	fmt.Println("服务端选项 (Native、Stream、WebTransport、H3、UDP和MASQUE模式):")
 	fmt.Println("  -addr string")
-	fmt.Println("        监听地址 (默认 \"0.0.0.0:4363\")")
+	fmt.Println("        监听地址，native模式同时接受stream、webtransport和h3模式的连接 (默认 \"0.0.0.0:4363\")")
+	fmt.Println("  -udp-addr string")
+	fmt.Println("        native模式下额外监听裸UDP的地址，使一个服务端即可支持对照测试 (默认不启用)")
 	fmt.Println()
 	fmt.Println("服务端选项 (LibP2P模式):")
 	fmt.Println("  -listen string")
 	fmt.Println("        监听的multiaddr (默认 \"/ip4/0.0.0.0/udp/4363/quic-v1\")")
+	fmt.Println("        libp2p-webrtc模式需指定webrtc-direct地址，例如 /ip4/0.0.0.0/udp/4363/webrtc-direct")
+	fmt.Println("  -rendezvous string")
+	fmt.Println("        连接bootstrap节点后在DHT中登记的rendezvous命名空间，为空时不登记 (默认 \"" + defaultRendezvous + "\")")
+	fmt.Println("  -dht")
+	fmt.Println("        没有配置bootstrap节点时也运行DHT并应答查询，作为其他节点的bootstrap节点")
+	fmt.Println("  -mdns")
+	fmt.Println("        通过mDNS在局域网内通告本节点 (服务名 " + mdnsServiceName + ")，仅libp2p模式")
 	fmt.Println()
-	fmt.Println("客户端选项 (Native模式):")
+	fmt.Println("客户端选项 (Native、Stream、WebTransport、H3、UDP和MASQUE模式):")
 	fmt.Println("  -server string")
-	fmt.Println("        服务器地址 (默认 \"localhost:4363\")")
+	fmt.Println("        服务器地址，masque模式下为目标UDP服务器 (默认 \"localhost:4363\")")
+	fmt.Println("  -proxy string")
+	fmt.Println("        masque模式的CONNECT-UDP代理地址，为空时在本进程启动只监听回环地址的代理")
 	fmt.Println()
 	fmt.Println("客户端选项 (LibP2P模式):")
 	fmt.Println("  -peer string")
-	fmt.Println("        目标节点的完整multiaddr (必需)")
+	fmt.Println("        目标节点的完整multiaddr；只给出Peer ID时经bootstrap节点在DHT中查找地址")
+	fmt.Println("  -rendezvous string")
+	fmt.Println("        代替 -peer，经bootstrap节点在DHT中查找在该命名空间下登记的服务端")
+	fmt.Println("  -discover")
+	fmt.Println("        通过mDNS查找局域网内使用 -mdns 的服务端并连接最先应答的一个；")
+	fmt.Println("        同时以 -peer 给出Peer ID时只连接该节点，仅libp2p模式")
+	fmt.Println("  -discover-wait duration")
+	fmt.Println("        等待mDNS应答的时间 (默认 3s)")
+	fmt.Println("  -discover-list")
+	fmt.Println("        只列出 -discover-wait 内发现的服务端及其multiaddr，不进行测试")
 	fmt.Println()
 	fmt.Println("客户端测试选项:")
 	fmt.Println("  -size int")
-	fmt.Println("        数据包大小（字节） (默认 1024)")
+	fmt.Println("        数据包大小（字节），32 到 65567 (默认 1024)")
 	fmt.Println("  -rate int")
 	fmt.Println("        发送速率（包/秒） (默认 100)")
+	fmt.Println("  -bitrate string")
+	fmt.Println("        目标线路比特率，例如 50M、800k、1.5G；按包大小和当前模式的每包协议开销推导发送速率，设置后忽略 -rate")
 	fmt.Println("  -duration duration")
 	fmt.Println("        测试持续时间 (默认 30s)")
 	fmt.Println("  -payload string")
-	fmt.Println("        负载类型: random 或 sequential (默认 \"random\")")
+	fmt.Println("        负载类型: random 或 sequential，接收端据此重新生成负载以检测损坏 (默认 \"random\")")
+	fmt.Println("  -echo")
+	fmt.Println("        接收服务端回显并统计往返时延RTT，不依赖两端时钟同步 (服务端需使用 -echo)")
+	fmt.Println("  -checksum")
+	fmt.Println("        在数据报头部携带CRC32C校验和，接收端校验失败时计为畸形数据报")
+	fmt.Println("  -down-rate int")
+	fmt.Println("        请求服务端在同一连接上发送下行数据报的速率（包/秒），0表示不启用 (默认 0)")
+	fmt.Println("  -down-size int")
+	fmt.Println("        下行数据包大小（字节），默认与 -size 相同")
+	fmt.Println("  -connections int")
+	fmt.Println("        从一个进程建立的独立连接数，每个连接有独立的发送和统计 (默认 1)")
+	fmt.Println("  -stagger duration")
+	fmt.Println("        多连接测试中相邻两个连接开始建立的间隔 (默认 100ms)")
+	fmt.Println("  -flows string")
+	fmt.Println("        在同一连接上并发发送多个流，格式 流ID:包大小:速率[:负载类型]，逗号分隔，设置后忽略 -size 和 -rate")
+	fmt.Println()
+	fmt.Println("  -probe-size")
+	fmt.Println("        测试前探测可用的最大数据报负载 (默认 true)")
+	fmt.Println("  -clamp-size")
+	fmt.Println("        -size 或 -down-size 超出探测到的上限时自动缩小，-clamp-size=false 时拒绝运行 (默认 true)")
+	fmt.Println()
+	fmt.Println("饱和测试选项:")
+	fmt.Println("  -saturate")
+	fmt.Println("        从 -rate 开始逐档翻倍提升速率，越过阈值后二分查找最高可持续速率")
+	fmt.Println("  -max-loss float")
+	fmt.Println("        丢包率阈值（百分比） (默认 1)")
+	fmt.Println("  -max-latency-growth duration")
+	fmt.Println("        相对第一档p50单向延迟的增长阈值 (默认 20ms)")
+	fmt.Println("  -step-duration duration")
+	fmt.Println("        每个档位的持续时间，矩阵测试同样适用 (默认 3s)")
+	fmt.Println("  -settle duration")
+	fmt.Println("        每个档位结束后等待在途数据报的时间，矩阵测试同样适用 (默认 500ms)")
+	fmt.Println("  -max-rate int")
+	fmt.Println("        速率上限（包/秒），不能小于起始速率 (默认 1000000)")
+	fmt.Println("  -saturate-iterations int")
+	fmt.Println("        二分查找的最大次数 (默认 6)")
+	fmt.Println()
+	fmt.Println("数据报与流混合测试选项:")
+	fmt.Println("  -bulk-streams int")
+	fmt.Println("        先只发送数据报测量空闲基线，再同时在指定数量的可靠流上发送批量数据，对比数据报的丢包、延迟和抖动 (默认 0，不启用)")
+	fmt.Println("  -bulk-rate string")
+	fmt.Println("        每条批量数据流的目标比特率，例如 20M，默认尽快发送")
+	fmt.Println()
+	fmt.Println("传输方式对照测试选项:")
+	fmt.Println("  -compare string")
+	fmt.Println("        依次用列出的传输方式运行相同负载 (-size、-rate/-bitrate、-duration)，在同一张表中对比，可选 udp、native、stream、webtransport、h3、masque")
+	fmt.Println("  -udp-server string")
+	fmt.Println("        对照测试中裸UDP服务端的地址 (服务端 -udp-addr)，列表包含udp或masque时必需")
+	fmt.Println()
+	fmt.Println("矩阵测试选项:")
+	fmt.Println("  -sizes string")
+	fmt.Println("        包大小列表或范围，例如 64,256,1024,1200 或 200-1200:200")
+	fmt.Println("  -rates string")
+	fmt.Println("        速率列表或范围（包/秒），未指定时使用 -rate；指定 -bitrate 时按包大小换算")
+	fmt.Println("  -csv string")
+	fmt.Println("        将对比表写入CSV文件")
 	fmt.Println()
 	fmt.Println("示例:")
 	fmt.Println()
@@ -113,10 +208,58 @@ func printHelp() {
 	fmt.Println("    服务端: go run *.go -mode native -addr 0.0.0.0:4363")
 	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -size 1024 -rate 100")
 	fmt.Println()
+	fmt.Println("  回显模式 (RTT测量):")
+	fmt.Println("    服务端: go run *.go -mode native -addr 0.0.0.0:4363 -echo")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -echo")
+	fmt.Println()
+	fmt.Println("  双向负载 (上行100pps + 下行500pps):")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -rate 100 -down-rate 500")
+	fmt.Println()
+	fmt.Println("  多连接负载测试 (50个连接，每20ms建立一个):")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -connections 50 -stagger 20ms -rate 200")
+	fmt.Println()
+	fmt.Println("  多流测试 (音频、视频和遥测共享一个连接):")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -flows 1:160:50,2:1200:500,3:64:10")
+	fmt.Println()
+	fmt.Println("  矩阵测试 (4种包大小 x 2种速率，同一连接):")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -sizes 64,256,1024,1200 -rates 1000,5000 -csv sweep.csv")
+	fmt.Println()
+	fmt.Println("  混合测试 (2条批量数据流对数据报延迟的影响):")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -rate 500 -bulk-streams 2 -duration 10s")
+	fmt.Println()
+	fmt.Println("  WebTransport模式 (native服务端同时接受WebTransport会话):")
+	fmt.Println("    客户端: go run *.go -mode webtransport -server localhost:4363 -echo")
+	fmt.Println()
+	fmt.Println("  MASQUE模式 (经CONNECT-UDP代理访问裸UDP服务端):")
+	fmt.Println("    服务端: go run *.go -mode udp -addr 0.0.0.0:4364")
+	fmt.Println("    代理:   go run *.go -mode masque -addr 0.0.0.0:4365")
+	fmt.Println("    客户端: go run *.go -mode masque -proxy localhost:4365 -server localhost:4364 -echo")
+	fmt.Println()
+	fmt.Println("  传输方式对照测试 (裸UDP、QUIC数据报、QUIC流、WebTransport):")
+	fmt.Println("    服务端: go run *.go -mode native -addr 0.0.0.0:4363 -udp-addr 0.0.0.0:4364")
+	fmt.Println("    客户端: go run *.go -server localhost:4363 -udp-server localhost:4364 -compare udp,native,stream,webtransport -rate 1000 -duration 10s")
+	fmt.Println()
+	fmt.Println("  饱和测试 (寻找丢包不超过0.5%的最高速率):")
+	fmt.Println("    客户端: go run *.go -mode native -server localhost:4363 -saturate -rate 1000 -max-loss 0.5")
+	fmt.Println()
 	fmt.Println("  LibP2P模式:")
 	fmt.Println("    服务端: go run *.go -mode libp2p -listen /ip4/0.0.0.0/udp/4363/quic-v1")
 	fmt.Println("    客户端: go run *.go -mode libp2p -peer /ip4/127.0.0.1/udp/4363/quic-v1/p2p/12D3KooW...")
 	fmt.Println()
+	fmt.Println("  LibP2P DHT发现 (bootstrap_nodes 中配置bootstrap节点):")
+	fmt.Println("    服务端: go run *.go -mode libp2p -listen /ip4/0.0.0.0/udp/4363/quic-v1")
+	fmt.Println("    客户端: go run *.go -mode libp2p -rendezvous " + defaultRendezvous)
+	fmt.Println("    客户端: go run *.go -mode libp2p -peer 12D3KooW...")
+	fmt.Println()
+	fmt.Println("  LibP2P mDNS局域网发现:")
+	fmt.Println("    服务端: go run *.go -mode libp2p -listen /ip4/0.0.0.0/udp/4363/quic-v1 -mdns")
+	fmt.Println("    客户端: go run *.go -mode libp2p -discover-list")
+	fmt.Println("    客户端: go run *.go -mode libp2p -discover")
+	fmt.Println()
+	fmt.Println("  LibP2P WebRTC-direct模式:")
+	fmt.Println("    服务端: go run *.go -mode libp2p-webrtc -listen /ip4/0.0.0.0/udp/4363/webrtc-direct")
+	fmt.Println("    客户端: go run *.go -mode libp2p-webrtc -peer /ip4/127.0.0.1/udp/4363/webrtc-direct/certhash/uEi.../p2p/12D3KooW...")
+	fmt.Println()
 	fmt.Println("配置文件位置: ~/.quic-datagram-test/")
 	fmt.Println()
 	fmt.Println("更多信息请查看 README.md")
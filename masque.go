@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// masqueUDPPathPrefix CONNECT-UDP默认URI模板的路径前缀，完整路径为 前缀/{target_host}/{target_port}/
+const masqueUDPPathPrefix = "/.well-known/masque/udp/"
+
+// masqueUDPPath 按RFC 9298的默认URI模板生成指向目标UDP地址的请求路径。
+// 模板变量中的IPv6地址需要把 ':' 编码为 %3A，url.PathEscape 不编码 ':'
+func masqueUDPPath(target string) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", fmt.Errorf("无效的目标地址 %q: %w", target, err)
+	}
+	host = strings.ReplaceAll(url.PathEscape(host), ":", "%3A")
+	return masqueUDPPathPrefix + host + "/" + port + "/", nil
+}
+
+// parseMasqueUDPPath 从请求路径中取出目标UDP地址
+func parseMasqueUDPPath(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, masqueUDPPathPrefix)
+	if !ok {
+		return "", fmt.Errorf("路径不是CONNECT-UDP模板: %s", path)
+	}
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("路径缺少目标主机或端口: %s", path)
+	}
+	return net.JoinHostPort(parts[0], parts[1]), nil
+}
+
+// masqueProxy CONNECT-UDP代理的请求处理
+type masqueProxy struct {
+	out io.Writer // 转发信息的输出目标
+}
+
+// ServeHTTP 处理CONNECT-UDP请求：为每个请求打开一个UDP套接字连接目标地址，
+// 在请求流的HTTP数据报和UDP数据报之间双向转发，直到请求流或连接关闭
+func (p *masqueProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, err := parseMasqueUDPPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(p.out, "CONNECT-UDP请求无效: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		fmt.Fprintf(p.out, "CONNECT-UDP解析目标 %s 失败: %v\n", target, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	socket, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		fmt.Fprintf(p.out, "CONNECT-UDP连接目标 %s 失败: %v\n", target, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer socket.Close()
+
+	stream, ok := acceptConnectUDP(w, r)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+	// 读取请求流上的capsule直到客户端关闭，使 ReceiveDatagram 随之返回
+	go io.Copy(io.Discard, stream)
+
+	fmt.Fprintf(p.out, "CONNECT-UDP %s -> %s (本地 %s)\n", r.RemoteAddr, target, socket.LocalAddr())
+
+	// 目标到客户端
+	var down atomic.Int64
+	go func() {
+		buf := make([]byte, udpMaxPayload)
+		for {
+			n, err := socket.Read(buf)
+			if err != nil {
+				return
+			}
+			if stream.SendDatagram(encodeUDPPayload(buf[:n])) == nil {
+				down.Add(1)
+			}
+		}
+	}()
+
+	// 客户端到目标
+	var up int64
+	for {
+		data, err := stream.ReceiveDatagram(context.Background())
+		if err != nil {
+			break
+		}
+		if payload, ok := decodeUDPPayload(data); ok {
+			if _, err := socket.Write(payload); err == nil {
+				up++
+			}
+		}
+	}
+	fmt.Fprintf(p.out, "CONNECT-UDP %s -> %s 结束: 转发上行 %d 个, 下行 %d 个数据报\n", r.RemoteAddr, target, up, down.Load())
+}
+
+// startMasqueProxy 在 addr 上启动CONNECT-UDP代理，返回实际监听地址和停止代理的函数，转发信息写入 out
+func startMasqueProxy(addr string, out io.Writer) (string, func(), error) {
+	socket, err := listenUDP(addr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(masqueUDPPathPrefix, &masqueProxy{out: out})
+	proxy := &http3.Server{
+		Handler:         mux,
+		TLSConfig:       http3.ConfigureTLSConfig(generateTLSConfig()),
+		QUICConfig:      &quic.Config{EnableDatagrams: true},
+		EnableDatagrams: true,
+	}
+	go proxy.Serve(socket)
+
+	return socket.LocalAddr().String(), func() {
+		proxy.Close()
+		socket.Close()
+	}, nil
+}
+
+// runMasqueProxy 以 -mode masque 运行独立的CONNECT-UDP代理
+func runMasqueProxy(config ServerConfig, out io.Writer) error {
+	addr, _, err := startMasqueProxy(config.Addr, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "MASQUE CONNECT-UDP 代理启动，监听地址: %s\n", addr)
+	fmt.Fprintf(out, "URI模板: https://%s%s{target_host}/{target_port}/\n", addr, masqueUDPPathPrefix)
+	select {}
+}
+
+// dialMasque 经 proxy 上的CONNECT-UDP代理连接目标UDP地址 target
+func dialMasque(ctx context.Context, proxy, target string) (*HTTPDatagramConnection, error) {
+	path, err := masqueUDPPath(target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialHTTPDatagram(ctx, proxy, path)
+	if err != nil {
+		return nil, err
+	}
+	conn.remote = target + " (经代理 " + proxy + ")"
+	return conn, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMasqueUDPPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"IPv4", "192.0.2.1:4433", "/.well-known/masque/udp/192.0.2.1/4433/"},
+		{"域名", "example.com:443", "/.well-known/masque/udp/example.com/443/"},
+		{"IPv6", "[2001:db8::1]:4433", "/.well-known/masque/udp/2001%3Adb8%3A%3A1/4433/"},
+		{"IPv6回环", "[::1]:443", "/.well-known/masque/udp/%3A%3A1/443/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := masqueUDPPath(tt.target)
+			if err != nil {
+				t.Fatalf("masqueUDPPath(%q) err = %v", tt.target, err)
+			}
+			if path != tt.want {
+				t.Errorf("masqueUDPPath(%q) = %q, want %q", tt.target, path, tt.want)
+			}
+
+			// 代理从解码后的请求路径中取回目标地址，编码须在请求URI中保留
+			u, err := url.Parse("https://proxy.example" + path)
+			if err != nil {
+				t.Fatalf("url.Parse err = %v", err)
+			}
+			if u.EscapedPath() != tt.want {
+				t.Errorf("请求URI路径 = %q, want %q", u.EscapedPath(), tt.want)
+			}
+			target, err := parseMasqueUDPPath(u.Path)
+			if err != nil {
+				t.Fatalf("parseMasqueUDPPath(%q) err = %v", u.Path, err)
+			}
+			if target != tt.target {
+				t.Errorf("parseMasqueUDPPath(%q) = %q, want %q", u.Path, target, tt.target)
+			}
+		})
+	}
+}
+
+func TestMasqueUDPPathInvalid(t *testing.T) {
+	for _, target := range []string{"", "192.0.2.1", "::1:443"} {
+		if _, err := masqueUDPPath(target); err == nil {
+			t.Errorf("masqueUDPPath(%q) 应返回错误", target)
+		}
+	}
+	for _, path := range []string{"/other/192.0.2.1/443/", masqueUDPPathPrefix + "192.0.2.1/", masqueUDPPathPrefix + "a/b/c/"} {
+		if _, err := parseMasqueUDPPath(path); err == nil {
+			t.Errorf("parseMasqueUDPPath(%q) 应返回错误", path)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/libp2p/zeroconf/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// mdnsServiceName 服务端通告的mDNS服务名，与libp2p默认的 _p2p._udp 区分，
+	// 局域网内其他libp2p节点（例如IPFS）不会被当作服务端
+	mdnsServiceName = "_quic-datagram-test._udp"
+	mdnsDomain      = "local"
+	// mdnsAddrPrefix libp2p的mDNS在TXT记录中携带multiaddr的前缀
+	mdnsAddrPrefix = "dnsaddr="
+	// defaultDiscoverWait 客户端等待mDNS应答的默认时间
+	defaultDiscoverWait = 3 * time.Second
+)
+
+// ignorePeers 服务端只通告自己，忽略发现的其他节点
+type ignorePeers struct{}
+
+func (ignorePeers) HandlePeerFound(peer.AddrInfo) {}
+
+// startMDNS 在局域网内通告服务端，TXT记录中携带 h 的监听地址。
+// libp2p不在mDNS中通告webrtc-direct地址，因此只用于libp2p (QUIC) 模式
+func startMDNS(h host.Host) (mdns.Service, error) {
+	service := mdns.NewMdnsService(h, mdnsServiceName, ignorePeers{})
+	if err := service.Start(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// discoverServers 浏览局域网内通告的服务端，按应答顺序返回，同一节点的地址合并。
+// 客户端只浏览不通告，因此不会被其他客户端发现。
+// stop 不为空时每发现一个新节点调用一次，返回true时立即结束；否则等待到 wait 超时
+func discoverServers(wait time.Duration, stop func(peer.AddrInfo) bool) ([]peer.AddrInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	// 浏览结束后不再读取，缓冲区避免mDNS协程阻塞
+	entries := make(chan *zeroconf.ServiceEntry, 64)
+	browseErr := make(chan error, 1)
+	go func() {
+		browseErr <- zeroconf.Browse(ctx, mdnsServiceName, mdnsDomain, entries)
+	}()
+
+	var found []peer.AddrInfo
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				// 浏览结束时关闭通道，等待 Browse 返回
+				entries = nil
+				continue
+			}
+			for _, info := range parseMDNSEntry(entry) {
+				known := false
+				for i := range found {
+					if found[i].ID == info.ID {
+						found[i].Addrs = mergeAddrs(found[i].Addrs, info.Addrs)
+						known = true
+					}
+				}
+				if known {
+					continue
+				}
+				found = append(found, info)
+				if stop != nil && stop(info) {
+					return found, nil
+				}
+			}
+		case err := <-browseErr:
+			if err != nil && ctx.Err() == nil {
+				return found, fmt.Errorf("mDNS浏览失败: %w", err)
+			}
+			return found, nil
+		}
+	}
+}
+
+// parseMDNSEntry 从TXT记录中取出服务端的multiaddr
+func parseMDNSEntry(entry *zeroconf.ServiceEntry) []peer.AddrInfo {
+	var addrs []ma.Multiaddr
+	for _, txt := range entry.Text {
+		s, ok := strings.CutPrefix(txt, mdnsAddrPrefix)
+		if !ok {
+			continue
+		}
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return nil
+	}
+	return infos
+}
+
+// mergeAddrs 把 b 中尚未出现的地址追加到 a
+func mergeAddrs(a, b []ma.Multiaddr) []ma.Multiaddr {
+	for _, addr := range b {
+		known := false
+		for _, existing := range a {
+			known = known || existing.Equal(addr)
+		}
+		if !known {
+			a = append(a, addr)
+		}
+	}
+	return a
+}
+
+// printDiscovered 列出发现的服务端及其完整multiaddr，可直接用作 -peer
+func printDiscovered(w io.Writer, found []peer.AddrInfo) {
+	fmt.Fprintf(w, "通过mDNS发现 %d 个服务端:\n", len(found))
+	for _, info := range found {
+		fmt.Fprintf(w, "  %s\n", info.ID)
+		for _, addr := range info.Addrs {
+			fmt.Fprintf(w, "    %s/p2p/%s\n", addr, info.ID)
+		}
+	}
+}
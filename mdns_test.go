@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/libp2p/zeroconf/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestParseMDNSEntry(t *testing.T) {
+	peers := randomPeers(t, 2)
+	quicAddr := "/ip4/192.168.1.10/udp/4363/quic-v1"
+	quicAddr6 := "/ip6/fe80::1/udp/4363/quic-v1"
+	withPeer := func(addr string, i int) string {
+		return mdnsAddrPrefix + addr + "/p2p/" + peers[i].String()
+	}
+
+	tests := []struct {
+		name      string
+		text      []string
+		wantPeers int
+		wantAddrs int // 第一个节点的地址数
+	}{
+		{"单个地址", []string{withPeer(quicAddr, 0)}, 1, 1},
+		{"同一节点的多个地址合并", []string{withPeer(quicAddr, 0), withPeer(quicAddr6, 0)}, 1, 2},
+		{"多个节点", []string{withPeer(quicAddr, 0), withPeer(quicAddr, 1)}, 2, 1},
+		{"忽略其他TXT记录和无效地址", []string{"version=1", mdnsAddrPrefix + "not-a-multiaddr", withPeer(quicAddr, 0)}, 1, 1},
+		{"地址不带Peer ID", []string{mdnsAddrPrefix + quicAddr}, 0, 0},
+		{"没有TXT记录", nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infos := parseMDNSEntry(&zeroconf.ServiceEntry{Text: tt.text})
+			if len(infos) != tt.wantPeers {
+				t.Fatalf("解析出 %d 个节点, want %d", len(infos), tt.wantPeers)
+			}
+			if tt.wantPeers > 0 && len(infos[0].Addrs) != tt.wantAddrs {
+				t.Errorf("第一个节点有 %d 个地址, want %d", len(infos[0].Addrs), tt.wantAddrs)
+			}
+		})
+	}
+}
+
+func TestMergeAddrs(t *testing.T) {
+	a := ma.StringCast("/ip4/192.168.1.10/udp/4363/quic-v1")
+	b := ma.StringCast("/ip4/10.0.0.2/udp/4363/quic-v1")
+	c := ma.StringCast("/ip6/fe80::1/udp/4363/quic-v1")
+
+	merged := mergeAddrs([]ma.Multiaddr{a, b}, []ma.Multiaddr{b, c, a})
+	if len(merged) != 3 || !merged[0].Equal(a) || !merged[1].Equal(b) || !merged[2].Equal(c) {
+		t.Errorf("mergeAddrs = %v, want [%s %s %s]", merged, a, b, c)
+	}
+}
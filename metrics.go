@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// latencyBuckets Prometheus延迟直方图的桶上界（从25µs到约3.3s，每档翻倍）
+var latencyBuckets = func() []time.Duration {
+	bounds := make([]time.Duration, 18)
+	for i := range bounds {
+		bounds[i] = 25 * time.Microsecond << uint(i)
+	}
+	return bounds
+}()
+
+// maxRetiredSeries 保留的已结束会话指标组数，超出后最早结束的一组不再导出
+const maxRetiredSeries = 4096
+
+var (
+	// 每个会话的每个流一组时间序列，单流测试的流ID为0；peer 为会话ID（远端地址或Peer ID）
+	flowLabels = []string{"mode", "peer", "flow"}
+	// 未通过校验的数据报不可信任其流ID，只按会话区分
+	sessionLabels = []string{"mode", "peer"}
+
+	descReceived = prometheus.NewDesc("quic_datagram_received_total",
+		"已接收的测试数据报数（不含重复包）", flowLabels, nil)
+	descBytes = prometheus.NewDesc("quic_datagram_received_bytes_total",
+		"已接收的测试数据报字节数", flowLabels, nil)
+	descGaps = prometheus.NewDesc("quic_datagram_gap_total",
+		"检测到的序列号缺口总数，包含之后乱序到达的包", flowLabels, nil)
+	descLost = prometheus.NewDesc("quic_datagram_lost_total",
+		"确认丢失的数据报数：移出接收窗口或会话结束时仍未到达", flowLabels, nil)
+	descReordered = prometheus.NewDesc("quic_datagram_reordered_total",
+		"乱序到达的数据报数", flowLabels, nil)
+	descDuplicate = prometheus.NewDesc("quic_datagram_duplicate_total",
+		"重复到达的数据报数", flowLabels, nil)
+	descLatency = prometheus.NewDesc("quic_datagram_latency_seconds",
+		"单向延迟分布（依赖两端时钟同步）", flowLabels, nil)
+	descJitter = prometheus.NewDesc("quic_datagram_jitter_seconds",
+		"活跃会话RFC 3550到达间隔抖动的当前值", flowLabels, nil)
+	descMalformed = prometheus.NewDesc("quic_datagram_malformed_total",
+		"头部校验失败的数据报数（魔数、版本、长度或校验和不符）", sessionLabels, nil)
+	descCorrupted = prometheus.NewDesc("quic_datagram_corrupted_total",
+		"校验和或负载内容与预期不符的数据报数", sessionLabels, nil)
+	descUntracked = prometheus.NewDesc("quic_datagram_untracked_total",
+		"超出每会话流数上限、未分流统计的数据报数", sessionLabels, nil)
+	descActive = prometheus.NewDesc("quic_datagram_active_connections",
+		"当前活跃连接数", []string{"mode"}, nil)
+	descConnections = prometheus.NewDesc("quic_datagram_connections_total",
+		"累计接受的连接数", []string{"mode"}, nil)
+)
+
+// metricKey 一组累计指标：传输方式、会话和流。invalid 组统计会话中未通过校验或超出流数上限的数据报
+type metricKey struct {
+	mode    string
+	peer    string
+	flow    uint32
+	invalid bool
+}
+
+// metricTotals 一组计数器的累计值，只保留导出指标需要的字段
+type metricTotals struct {
+	received, bytes, gaps, lost     int64
+	reordered, duplicate            int64
+	malformed, corrupted, untracked int64
+	latencyCount                    uint64
+	latencySum                      time.Duration
+	latencyBuckets                  []uint64 // 按 latencyBuckets 的累积计数
+}
+
+func newMetricTotals() *metricTotals {
+	return &metricTotals{latencyBuckets: make([]uint64, len(latencyBuckets))}
+}
+
+// add 累加一个统计记录。settled 表示记录已不再更新，仍缺失的包不会再到达，全部计为确认丢失；
+// 活跃的记录只计已移出接收窗口的丢包，因此计数器只增不减
+func (t *metricTotals) add(stats *ServerStats, settled bool) {
+	stats.mutex.RLock()
+	defer stats.mutex.RUnlock()
+
+	t.received += stats.ReceivedCount
+	t.bytes += stats.ReceivedBytes
+	t.gaps += stats.LostCount + stats.ReorderedCount
+	if settled {
+		t.lost += stats.LostCount
+	} else {
+		t.lost += stats.ExpiredCount
+	}
+	t.reordered += stats.ReorderedCount
+	t.duplicate += stats.DuplicateCount
+	t.malformed += stats.MalformedCount
+	t.corrupted += stats.CorruptedCount
+	t.untracked += stats.UntrackedCount
+
+	t.latencyCount += stats.Histogram.Count()
+	t.latencySum += stats.TotalLatency
+	for i, n := range stats.Histogram.CumulativeCounts(latencyBuckets) {
+		t.latencyBuckets[i] += n
+	}
+}
+
+// merge 累加另一组计数器
+func (t *metricTotals) merge(other *metricTotals) {
+	t.received += other.received
+	t.bytes += other.bytes
+	t.gaps += other.gaps
+	t.lost += other.lost
+	t.reordered += other.reordered
+	t.duplicate += other.duplicate
+	t.malformed += other.malformed
+	t.corrupted += other.corrupted
+	t.untracked += other.untracked
+	t.latencyCount += other.latencyCount
+	t.latencySum += other.latencySum
+	for i, n := range other.latencyBuckets {
+		t.latencyBuckets[i] += n
+	}
+}
+
+// clone 返回可独立累加的副本
+func (t *metricTotals) clone() *metricTotals {
+	c := *t
+	c.latencyBuckets = append([]uint64(nil), t.latencyBuckets...)
+	return &c
+}
+
+// addFlows 将一个会话的各流和无效数据报统计累加到 totals
+func addFlows(totals map[metricKey]*metricTotals, mode, peer string, flows *FlowSet, settled bool) {
+	add := func(key metricKey, stats *ServerStats) {
+		if totals[key] == nil {
+			totals[key] = newMetricTotals()
+		}
+		totals[key].add(stats, settled)
+	}
+	add(metricKey{mode: mode, peer: peer, invalid: true}, flows.Invalid())
+	for _, id := range flows.IDs() {
+		add(metricKey{mode: mode, peer: peer, flow: id}, flows.Flow(id))
+	}
+}
+
+// Describe 实现 prometheus.Collector
+func (s *Server) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		descReceived, descBytes, descGaps, descLost, descReordered, descDuplicate, descLatency, descJitter,
+		descMalformed, descCorrupted, descUntracked, descActive, descConnections,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect 实现 prometheus.Collector，抓取时直接从各会话的统计记录生成指标。
+// 计数器取已结束和已重置的累计值与活跃会话之和，会话结束或客户端开始新测试时不会回落
+func (s *Server) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.Lock()
+	totals := make(map[metricKey]*metricTotals, len(s.retired))
+	for key, retired := range s.retired {
+		totals[key] = retired.clone()
+	}
+	sessions := make([]*Session, 0, len(s.sessions))
+	active := make(map[string]int)
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+		active[session.Mode]++
+		addFlows(totals, session.Mode, session.ID, session.Flows(), false)
+	}
+	accepted := maps.Clone(s.accepted)
+	s.mutex.Unlock()
+
+	for key, t := range totals {
+		if key.invalid {
+			ch <- prometheus.MustNewConstMetric(descMalformed, prometheus.CounterValue, float64(t.malformed), key.mode, key.peer)
+			ch <- prometheus.MustNewConstMetric(descCorrupted, prometheus.CounterValue, float64(t.corrupted), key.mode, key.peer)
+			ch <- prometheus.MustNewConstMetric(descUntracked, prometheus.CounterValue, float64(t.untracked), key.mode, key.peer)
+			continue
+		}
+		collectCounters(ch, t, key.mode, key.peer, strconv.FormatUint(uint64(key.flow), 10))
+	}
+	for _, session := range sessions {
+		flows := session.Flows()
+		for _, id := range flows.IDs() {
+			stats := flows.Flow(id)
+			stats.mutex.RLock()
+			jitter := stats.Jitter.Current()
+			stats.mutex.RUnlock()
+			ch <- prometheus.MustNewConstMetric(descJitter, prometheus.GaugeValue, jitter.Seconds(),
+				session.Mode, session.ID, strconv.FormatUint(uint64(id), 10))
+		}
+	}
+	for mode, n := range accepted {
+		ch <- prometheus.MustNewConstMetric(descActive, prometheus.GaugeValue, float64(active[mode]), mode)
+		ch <- prometheus.MustNewConstMetric(descConnections, prometheus.CounterValue, float64(n), mode)
+	}
+}
+
+// collectCounters 生成一个流的累计指标
+func collectCounters(ch chan<- prometheus.Metric, t *metricTotals, labels ...string) {
+	ch <- prometheus.MustNewConstMetric(descReceived, prometheus.CounterValue, float64(t.received), labels...)
+	ch <- prometheus.MustNewConstMetric(descBytes, prometheus.CounterValue, float64(t.bytes), labels...)
+	ch <- prometheus.MustNewConstMetric(descGaps, prometheus.CounterValue, float64(t.gaps), labels...)
+	ch <- prometheus.MustNewConstMetric(descLost, prometheus.CounterValue, float64(t.lost), labels...)
+	ch <- prometheus.MustNewConstMetric(descReordered, prometheus.CounterValue, float64(t.reordered), labels...)
+	ch <- prometheus.MustNewConstMetric(descDuplicate, prometheus.CounterValue, float64(t.duplicate), labels...)
+
+	buckets := make(map[float64]uint64, len(latencyBuckets))
+	for i, bound := range latencyBuckets {
+		buckets[bound.Seconds()] = t.latencyBuckets[i]
+	}
+	ch <- prometheus.MustNewConstHistogram(descLatency, t.latencyCount, t.latencySum.Seconds(), buckets, labels...)
+}
+
+// serveMetrics 在指定地址启动HTTP监听，通过 /metrics 暴露Prometheus指标
+func (s *Server) serveMetrics(addr string) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		s,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	fmt.Fprintf(s.out, "Prometheus指标地址: http://%s/metrics\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Fprintf(s.out, "指标HTTP服务错误: %v\n", err)
+	}
+}
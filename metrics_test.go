@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherCounter 返回指定计数器在给定标签下的值，不存在时返回 -1
+func gatherCounter(t *testing.T, s *Server, name string, labels map[string]string) float64 {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(s)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metricLabelsMatch(metric, labels) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return -1
+}
+
+func metricLabelsMatch(metric *dto.Metric, labels map[string]string) bool {
+	if len(metric.GetLabel()) != len(labels) {
+		return false
+	}
+	for _, pair := range metric.GetLabel() {
+		if labels[pair.GetName()] != pair.GetValue() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMetricsCountersCumulative(t *testing.T) {
+	s := NewServer(ServerConfig{Mode: "native"}, nil)
+	s.out = io.Discard
+	session := s.openSession("10.0.0.1:5000", "stream")
+	flow := map[string]string{"mode": "stream", "peer": "10.0.0.1:5000", "flow": "0"}
+
+	for _, seq := range []uint64{1, 2, 4, 5} {
+		session.Flows().ProcessPacket(testPacket(0, seq), io.Discard, false)
+	}
+	if got := gatherCounter(t, s, "quic_datagram_received_total", flow); got != 4 {
+		t.Fatalf("received = %v, want 4", got)
+	}
+	// 缺失的3仍在接收窗口内，可能迟到，尚未确认丢失
+	if got := gatherCounter(t, s, "quic_datagram_lost_total", flow); got != 0 {
+		t.Fatalf("活跃会话的 lost = %v, want 0", got)
+	}
+
+	// 重置后旧记录并入累计值，计数器不回落；会话结束时仍缺失的包确认丢失
+	s.resetSession(session)
+	session.Flows().ProcessPacket(testPacket(0, 1), io.Discard, false)
+	if got := gatherCounter(t, s, "quic_datagram_received_total", flow); got != 5 {
+		t.Fatalf("重置后 received = %v, want 5", got)
+	}
+	if got := gatherCounter(t, s, "quic_datagram_lost_total", flow); got != 1 {
+		t.Fatalf("重置后 lost = %v, want 1", got)
+	}
+
+	s.closeSession(session)
+	if got := gatherCounter(t, s, "quic_datagram_received_total", flow); got != 5 {
+		t.Fatalf("会话结束后 received = %v, want 5", got)
+	}
+
+	// 同一地址重新连接后继续累加
+	session = s.openSession("10.0.0.1:5000", "stream")
+	session.Flows().ProcessPacket(testPacket(0, 1), io.Discard, false)
+	if got := gatherCounter(t, s, "quic_datagram_received_total", flow); got != 6 {
+		t.Fatalf("重新连接后 received = %v, want 6", got)
+	}
+}
+
+func TestMetricsLostExpiresFromWindow(t *testing.T) {
+	s := NewServer(ServerConfig{Mode: "native"}, nil)
+	session := s.openSession("peer", "native")
+	flow := map[string]string{"mode": "native", "peer": "peer", "flow": "0"}
+
+	session.Flows().ProcessPacket(testPacket(0, 1), io.Discard, false)
+	session.Flows().ProcessPacket(testPacket(0, 3), io.Discard, false)
+	session.Flows().ProcessPacket(testPacket(0, seqWindowSize+2), io.Discard, false)
+	if got := gatherCounter(t, s, "quic_datagram_lost_total", flow); got != 1 {
+		t.Fatalf("移出窗口后 lost = %v, want 1", got)
+	}
+}
+
+func TestMetricsInvalidPacketsPerSession(t *testing.T) {
+	s := NewServer(ServerConfig{Mode: "native"}, nil)
+	session := s.openSession("peer", "native")
+
+	bad := testPacket(7, 1)
+	bad[0] ^= 0xff
+	session.Flows().ProcessPacket(bad, io.Discard, false)
+
+	labels := map[string]string{"mode": "native", "peer": "peer"}
+	if got := gatherCounter(t, s, "quic_datagram_malformed_total", labels); got != 1 {
+		t.Fatalf("malformed = %v, want 1", got)
+	}
+	if got := gatherCounter(t, s, "quic_datagram_received_total",
+		map[string]string{"mode": "native", "peer": "peer", "flow": "7"}); got != -1 {
+		t.Fatal("未通过校验的数据报不应创建流的时间序列")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// sizeProbeCeiling 第一次探测使用的长度，超出任何QUIC包的容量，
+	// 用于从 DatagramTooLargeError 中取得协议栈当前允许的最大负载
+	sizeProbeCeiling = 65535
+	// sizeProbeFloor 最小探测长度，需大于未填充的探测消息长度（头部加上JSON消息体）
+	sizeProbeFloor = 128
+	// sizeProbeRetries 每个探测长度的最大尝试次数，路径上被丢弃的大包很快判为不可达
+	sizeProbeRetries = 3
+)
+
+// errSizeProbeUnsupported 服务端没有确认最小长度的探测，通常是不支持尺寸探测的旧版本
+var errSizeProbeUnsupported = errors.New("可能是不支持尺寸探测的旧版本")
+
+// SizeProbeResult 数据报负载尺寸探测结果
+type SizeProbeResult struct {
+	StackLimit  int  `json:"stack_limit"` // quic-go报告的当前最大负载，0表示未报告
+	MaxSize     int  `json:"max_size"`    // 经服务端确认可到达的最大负载
+	Probes      int  `json:"probes"`
+	Unconfirmed bool `json:"unconfirmed,omitempty"` // 服务端未回应探测，MaxSize 取协议栈上限
+}
+
+// sendSizeProbe 发送一个指定长度的探测并等待服务端确认。
+// 多次重发仍未确认时返回 false 和 nil；协议栈拒绝发送时返回错误。
+func (c *Client) sendSizeProbe(size int, result *SizeProbeResult) (bool, error) {
+	result.Probes++
+	body, err := c.controlRequestRetries(ControlSizeProbe, &SizeProbe{Size: size}, ControlSizeProbeAck, sizeProbeRetries)
+	if errors.Is(err, errControlTimeout) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var ack SizeProbeAck
+	if err := json.Unmarshal(body, &ack); err != nil {
+		return false, fmt.Errorf("解析尺寸探测确认失败: %w", err)
+	}
+	return ack.Received == size, nil
+}
+
+// probeDatagramSize 探测本连接可用的最大数据报负载。
+// 先以超大探测从 DatagramTooLargeError 取得quic-go允许的上限，
+// 再在该上限以下二分查找服务端能够收到的最大长度，
+// 以发现路径上被丢弃而协议栈并不知道的大包。
+func (c *Client) probeDatagramSize() (SizeProbeResult, error) {
+	var result SizeProbeResult
+
+	upper := sizeProbeCeiling
+	ok, err := c.sendSizeProbe(upper, &result)
+	var tooLarge *quic.DatagramTooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		upper = int(tooLarge.MaxDatagramPayloadSize)
+		result.StackLimit = upper
+	case err != nil:
+		return result, err
+	case ok:
+		result.MaxSize = upper
+		return result, nil
+	}
+
+	// 多数路径上协议栈的上限可以直接到达
+	ok, err = c.sendSizeProbe(upper, &result)
+	if err != nil && !errors.As(err, &tooLarge) {
+		return result, err
+	}
+	if ok {
+		result.MaxSize = upper
+		return result, nil
+	}
+
+	ok, err = c.sendSizeProbe(sizeProbeFloor, &result)
+	if err != nil {
+		return result, err
+	}
+	if !ok {
+		return result, fmt.Errorf("服务端未确认 %d 字节的尺寸探测，%w", sizeProbeFloor, errSizeProbeUnsupported)
+	}
+
+	// 二分查找，good 已确认可达，bad 已确认不可达
+	good, bad := sizeProbeFloor, upper
+	for bad-good > 1 {
+		mid := (good + bad) / 2
+		ok, err := c.sendSizeProbe(mid, &result)
+		if err != nil && !errors.As(err, &tooLarge) {
+			return result, err
+		}
+		if ok {
+			good = mid
+		} else {
+			bad = mid
+		}
+	}
+	result.MaxSize = good
+	return result, nil
+}
+
+// checkPacketSize 探测最大负载，并在 -size 或 -down-size 超出时缩小或拒绝运行
+func (c *Client) checkPacketSize() error {
+	c.logf("正在探测可用的最大数据报负载...\n")
+	result, err := c.probeDatagramSize()
+	if errors.Is(err, errSizeProbeUnsupported) {
+		// 旧版本服务端不回应探测时不中止测试：有协议栈上限则按上限检查，否则保留原来的包大小
+		if result.StackLimit == 0 {
+			fmt.Fprintf(c.out, "警告: %v，跳过尺寸检查，使用 -size %d\n", err, c.config.PacketSize)
+			return nil
+		}
+		fmt.Fprintf(c.out, "警告: %v，改用协议栈的上限 %d 字节\n", err, result.StackLimit)
+		result.MaxSize = result.StackLimit
+		result.Unconfirmed = true
+	} else if err != nil {
+		return fmt.Errorf("尺寸探测失败: %w", err)
+	}
+	c.sizeProbe = &result
+
+	if result.StackLimit > 0 {
+		c.logf("协议栈当前允许的最大数据报负载: %d 字节\n", result.StackLimit)
+	}
+	if !result.Unconfirmed {
+		c.logf("探测到的最大可用负载: %d 字节 (共 %d 次探测)\n", result.MaxSize, result.Probes)
+	}
+	if result.StackLimit > 0 && result.MaxSize < result.StackLimit {
+		fmt.Fprintf(c.out, "超过 %d 字节的数据报在路径上被丢弃，协议栈的MTU估计偏大\n", result.MaxSize)
+	}
+
+	type sizeParam struct {
+		name  string
+		value *int
+	}
+	params := []sizeParam{{"-size", &c.config.PacketSize}}
+	if c.downlinkEnabled() {
+		params = append(params, sizeParam{"-down-size", &c.config.DownSize})
+	}
+	for _, flow := range c.flows {
+		params = append(params, sizeParam{fmt.Sprintf("流 %d 的包大小", flow.Spec.ID), &flow.Spec.Size})
+	}
+
+	for _, size := range params {
+		if *size.value <= result.MaxSize {
+			continue
+		}
+		if !c.config.ClampSize {
+			return fmt.Errorf("%s %d 超出可用的最大数据报负载 %d 字节，每个数据报都会发送失败或被丢弃；"+
+				"请使用不超过 %d 的 %s，或去掉 -clamp-size=false 以自动缩小",
+				size.name, *size.value, result.MaxSize, result.MaxSize, size.name)
+		}
+		fmt.Fprintf(c.out, "%s %d 超出可用的最大数据报负载，已缩小为 %d 字节\n", size.name, *size.value, result.MaxSize)
+		*size.value = result.MaxSize
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConnectionResult 多连接测试中单个连接的结果
+type ConnectionResult struct {
+	Index   int             `json:"index"`
+	SetupNs int64           `json:"setup_ns,omitempty"` // 建立连接（含握手）的耗时
+	Error   string          `json:"error,omitempty"`
+	Client  *ClientSnapshot `json:"client,omitempty"`
+	Server  *ServerSnapshot `json:"server,omitempty"`
+
+	client *Client
+}
+
+// runConnection 建立一个独立的连接并在其上运行一次测试。
+// libp2p模式下除第一个连接外都使用临时身份，使服务端把每个连接视为不同的节点。
+func runConnection(out io.Writer, index int, config ClientConfig, bitrate float64, flows []FlowSpec, p2pConfig *Config) ConnectionResult {
+	result := ConnectionResult{Index: index + 1}
+
+	client := newClient(config, nil, flows)
+	client.out = out
+	client.quiet = true
+	if p2pConfig != nil && index > 0 {
+		key, err := GenerateRandomKey()
+		if err != nil {
+			result.Error = fmt.Sprintf("生成临时身份失败: %v", err)
+			return result
+		}
+		ephemeral := *p2pConfig
+		ephemeral.PrivateKey = key
+		p2pConfig = &ephemeral
+	}
+
+	if err := client.connect(p2pConfig); err != nil {
+		result.Error = fmt.Sprintf("连接失败: %v", err)
+		fmt.Fprintf(out, "连接 #%d %s\n", result.Index, result.Error)
+		return result
+	}
+	defer client.conn.Close()
+	result.client = client
+	result.SetupNs = int64(client.setupTime)
+	fmt.Fprintf(out, "连接 #%d 已建立，耗时 %v\n", result.Index, client.setupTime.Round(time.Microsecond))
+
+	stopReceive := client.startReceive()
+	defer stopReceive()
+
+	if err := client.prepare(bitrate); err != nil {
+		result.Error = err.Error()
+		fmt.Fprintf(out, "连接 #%d %v\n", result.Index, err)
+		return result
+	}
+
+	server, _, err := client.runTest()
+	snap := client.snapshot()
+	result.Client = &snap
+	result.Server = server
+	if err != nil {
+		result.Error = err.Error()
+		fmt.Fprintf(out, "连接 #%d 测试失败: %v\n", result.Index, err)
+		return result
+	}
+	fmt.Fprintf(out, "连接 #%d 测试完成，发送 %d 个包\n", result.Index, snap.Sent)
+	return result
+}
+
+// runMultiClient 从一个进程建立多个独立连接，按 -stagger 间隔依次启动，
+// 每个连接有独立的发送和统计，结束后输出每个连接和汇总的结果
+func runMultiClient(config ClientConfig, reporter *Reporter, bitrate float64, flows []FlowSpec, p2pConfig *Config) {
+	n := config.Connections
+	out := reporter.Text()
+	fmt.Fprintf(out, "多连接测试: %d 个连接，每隔 %v 启动一个，每个连接发送 %v\n", n, config.Stagger, config.Duration)
+
+	start := time.Now()
+	results := make([]ConnectionResult, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if i > 0 && config.Stagger > 0 {
+			time.Sleep(config.Stagger)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runConnection(out, i, config, bitrate, flows, p2pConfig)
+		}(i)
+	}
+	wg.Wait()
+
+	aggregate := PrintConnections(out, results)
+
+	if reporter.Enabled() {
+		reporter.Write(ResultDocument{
+			Type:        "result",
+			Role:        "client",
+			Mode:        config.Mode,
+			Version:     Version,
+			StartTime:   start,
+			EndTime:     time.Now(),
+			Params:      config,
+			Client:      aggregate,
+			Connections: results,
+		})
+	}
+}
+
+// PrintConnections 打印每个连接的结果和汇总，返回所有成功连接合并后的发送统计
+func PrintConnections(w io.Writer, results []ConnectionResult) *ClientSnapshot {
+	fmt.Fprintf(w, "\n=== 多连接测试结果 ===\n")
+	fmt.Fprintf(w, "%6s %12s %10s %12s %10s %10s %12s %12s %14s  %s\n",
+		"连接", "建立耗时", "发送", "速率(pps)", "服务端接收", "丢包率", "p50", "p99", "接收有效吞吐", "状态")
+
+	total := &ClientStats{}
+	var parts []ClientSnapshot
+	var setups []time.Duration
+	var setupTotal time.Duration
+	var received, sentWithServer int64
+	var goodput float64
+	var worstP99 time.Duration
+
+	for _, result := range results {
+		status := "OK"
+		if result.Error != "" {
+			status = result.Error
+		}
+		if result.client == nil {
+			fmt.Fprintf(w, "%6d %12s %10s %12s %10s %10s %12s %12s %14s  %s\n",
+				result.Index, "-", "-", "-", "-", "-", "-", "-", "-", status)
+			continue
+		}
+
+		setup := time.Duration(result.SetupNs)
+		setups = append(setups, setup)
+		setupTotal += setup
+		result.client.mergeStatsInto(total)
+		if result.Client == nil {
+			fmt.Fprintf(w, "%6d %12v %10s %12s %10s %10s %12s %12s %14s  %s\n",
+				result.Index, setup.Round(time.Microsecond), "-", "-", "-", "-", "-", "-", "-", status)
+			continue
+		}
+		parts = append(parts, *result.Client)
+
+		if result.Server == nil {
+			fmt.Fprintf(w, "%6d %12v %10d %12.2f %10s %10s %12s %12s %14s  %s\n",
+				result.Index, setup.Round(time.Microsecond), result.Client.Sent, result.Client.Rate,
+				"-", "-", "-", "-", "-", status)
+			continue
+		}
+
+		server := result.Server
+		missing := result.Client.Sent - server.Received
+		if missing < 0 {
+			missing = 0
+		}
+		lossRate := 0.0
+		if result.Client.Sent > 0 {
+			lossRate = float64(missing) / float64(result.Client.Sent)
+		}
+		received += server.Received
+		sentWithServer += result.Client.Sent
+		goodput += server.GoodputBps
+		if p99 := time.Duration(server.Latency.P99Ns); p99 > worstP99 {
+			worstP99 = p99
+		}
+		fmt.Fprintf(w, "%6d %12v %10d %12.2f %10d %9.2f%% %12v %12v %14s  %s\n",
+			result.Index, setup.Round(time.Microsecond), result.Client.Sent, result.Client.Rate,
+			server.Received, lossRate*100, time.Duration(server.Latency.P50Ns), time.Duration(server.Latency.P99Ns),
+			FormatBitrate(server.GoodputBps), status)
+	}
+
+	fmt.Fprintf(w, "\n成功建立 %d/%d 个连接\n", len(setups), len(results))
+	if len(setups) > 0 {
+		sort.Slice(setups, func(i, j int) bool { return setups[i] < setups[j] })
+		fmt.Fprintf(w, "建立耗时: 最小 %v, p50 %v, 最大 %v\n",
+			setups[0].Round(time.Microsecond), setups[len(setups)/2].Round(time.Microsecond),
+			setups[len(setups)-1].Round(time.Microsecond))
+		// 按各连接握手耗时之和计算，不受 -stagger 启动间隔影响
+		if setupTotal > 0 {
+			fmt.Fprintf(w, "连接建立速率: %.1f 连接/秒\n", float64(len(setups))/setupTotal.Seconds())
+		}
+	}
+
+	if len(parts) == 0 {
+		fmt.Fprintf(w, "======================\n")
+		return nil
+	}
+	aggregate := mergeClientSnapshots(total, parts)
+	fmt.Fprintf(w, "汇总发送: %d 个包, 失败 %d, 发送速率 %.2f pps, 发送有效吞吐 %s\n",
+		aggregate.Sent, aggregate.Errors, aggregate.Rate, FormatBitrate(aggregate.GoodputBps))
+	if sentWithServer > 0 {
+		missing := sentWithServer - received
+		if missing < 0 {
+			missing = 0
+		}
+		fmt.Fprintf(w, "汇总接收: %d 个包, 端到端丢包 %d (%.2f%%), 接收有效吞吐 %s, 最差连接p99单向延迟 %v\n",
+			received, missing, float64(missing)/float64(sentWithServer)*100, FormatBitrate(goodput), worstP99)
+	}
+	if aggregate.RTT != nil {
+		fmt.Fprintf(w, "汇总往返时延: p50=%v p99=%v\n", time.Duration(aggregate.RTT.P50Ns), time.Duration(aggregate.RTT.P99Ns))
+	}
+	fmt.Fprintf(w, "======================\n")
+	return &aggregate
+}
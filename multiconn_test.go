@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintConnectionsSetupRate(t *testing.T) {
+	results := []ConnectionResult{
+		{Index: 1, SetupNs: int64(10 * time.Millisecond), client: &Client{}},
+		{Index: 2, Error: "连接失败: timeout"},
+		{Index: 3, SetupNs: int64(30 * time.Millisecond), client: &Client{}},
+	}
+
+	var out bytes.Buffer
+	if aggregate := PrintConnections(&out, results); aggregate != nil {
+		t.Errorf("没有完成测试的连接时汇总应为 nil, got %+v", aggregate)
+	}
+	for _, want := range []string{
+		"成功建立 2/3 个连接",
+		"建立耗时: 最小 10ms, p50 30ms, 最大 30ms",
+		// 2个连接共耗时40ms，与启动间隔无关
+		"连接建立速率: 50.0 连接/秒",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("输出中没有 %q:\n%s", want, out.String())
+		}
+	}
+}
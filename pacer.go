@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// pacerMaxLag 令牌桶最多累积的时间，发送循环落后时可以通过突发追赶这么长时间的配额，
+	// 超过部分被丢弃并体现为速率误差
+	pacerMaxLag = 50 * time.Millisecond
+	// pacerSpinThreshold 等待时间短于该值时让出CPU轮询，而不是依赖粒度较粗的定时器
+	pacerSpinThreshold = 50 * time.Microsecond
+)
+
+// ErrInvalidRate 速率不是正数时 Wait 返回的错误，此时永远等不到令牌
+var ErrInvalidRate = errors.New("发送速率必须大于0")
+
+// Pacer 基于令牌桶的发送速率控制器。
+// 与 time.Ticker 不同，定时器的延迟和合并不会降低平均速率：
+// 落后时 Wait 一次返回多个令牌，调用方以突发方式追赶。
+type Pacer struct {
+	rate     float64 // 包/秒
+	capacity float64
+	tokens   float64
+	last     time.Time
+	mutex    sync.Mutex
+}
+
+// NewPacer 创建指定速率（包/秒）的Pacer，rate 不大于0时 Wait 返回 ErrInvalidRate
+func NewPacer(rate float64) *Pacer {
+	p := &Pacer{last: time.Now()}
+	p.SetRate(rate)
+	// 第一个包立即发送
+	p.tokens = 1
+	return p
+}
+
+// SetRate 修改发送速率，已累积的令牌保留
+func (p *Pacer) SetRate(rate float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.refill(time.Now())
+	p.rate = rate
+	p.capacity = rate * pacerMaxLag.Seconds()
+	if p.capacity < 1 {
+		p.capacity = 1
+	}
+	if p.tokens > p.capacity {
+		p.tokens = p.capacity
+	}
+}
+
+// Rate 返回当前速率
+func (p *Pacer) Rate() float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.rate
+}
+
+func (p *Pacer) refill(now time.Time) {
+	p.tokens += now.Sub(p.last).Seconds() * p.rate
+	if p.tokens > p.capacity {
+		p.tokens = p.capacity
+	}
+	p.last = now
+}
+
+// Wait 阻塞直到至少有一个令牌可用，返回本次允许发送的包数
+func (p *Pacer) Wait(ctx context.Context) (int, error) {
+	for {
+		p.mutex.Lock()
+		if !(p.rate > 0) {
+			p.mutex.Unlock()
+			return 0, ErrInvalidRate
+		}
+		p.refill(time.Now())
+		if p.tokens >= 1 {
+			n := int(p.tokens)
+			p.tokens -= float64(n)
+			p.mutex.Unlock()
+			return n, nil
+		}
+		wait := time.Duration((1 - p.tokens) / p.rate * float64(time.Second))
+		p.mutex.Unlock()
+
+		if wait < pacerSpinThreshold {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			runtime.Gosched()
+			continue
+		}
+
+		timer := time.NewTimer(wait - pacerSpinThreshold/2)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+	}
+}
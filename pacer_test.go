@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPacerTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		elapsed time.Duration // 距上次补充令牌经过的时间
+		want    int
+	}{
+		{"初始令牌", 1000, 0, 1},
+		{"按速率累积", 1000, 10 * time.Millisecond, 11},
+		{"不超过最大落后时间的配额", 1000, time.Second, 50},
+		{"低速率至少一个令牌", 10, time.Second, 1},
+		{"高速率突发", 100000, 20 * time.Millisecond, 2001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPacer(tt.rate)
+			p.last = p.last.Add(-tt.elapsed)
+			n, err := p.Wait(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 测试本身的耗时可能多补充极少量令牌
+			if n < tt.want || n > tt.want+tt.want/100+1 {
+				t.Errorf("Wait() = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacerSetRate(t *testing.T) {
+	p := NewPacer(1000)
+	p.last = p.last.Add(-time.Second)
+	// 降低速率时已累积的令牌不超过新的容量
+	p.SetRate(100)
+	if p.Rate() != 100 {
+		t.Fatalf("Rate() = %v, want 100", p.Rate())
+	}
+	n, err := p.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("Wait() = %d, want 5", n)
+	}
+}
+
+func TestPacerRate(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		duration time.Duration
+	}{
+		{200, 250 * time.Millisecond},
+		{5000, 200 * time.Millisecond},
+		{200000, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), tt.duration)
+		p := NewPacer(tt.rate)
+		start := time.Now()
+		sent := 0
+		for {
+			n, err := p.Wait(ctx)
+			if err != nil {
+				break
+			}
+			sent += n
+		}
+		cancel()
+
+		want := tt.rate * time.Since(start).Seconds()
+		if float64(sent) < want*0.9 || float64(sent) > want*1.05+1 {
+			t.Errorf("速率 %v: %v 内发放 %d 个令牌, want 约 %.0f", tt.rate, tt.duration, sent, want)
+		}
+	}
+}
+
+func TestPacerWaitCanceled(t *testing.T) {
+	p := NewPacer(1)
+	if _, err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Wait(ctx); err == nil {
+		t.Fatal("令牌耗尽时 Wait 应在ctx取消后返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("取消后 Wait 耗时 %v", elapsed)
+	}
+}
+
+func TestPacerInvalidRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		setRate bool // 先以有效速率创建，再用 SetRate 改为 rate
+	}{
+		{"零", 0, false},
+		{"负数", -10, false},
+		{"NaN", math.NaN(), false},
+		{"SetRate改为零", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPacer(tt.rate)
+			if tt.setRate {
+				p = NewPacer(1000)
+				p.SetRate(tt.rate)
+			}
+			done := make(chan error, 1)
+			go func() {
+				_, err := p.Wait(context.Background())
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if !errors.Is(err, ErrInvalidRate) {
+					t.Errorf("Wait() err = %v, want %v", err, ErrInvalidRate)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("速率无效时 Wait 没有返回")
+			}
+		})
+	}
+}
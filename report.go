@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 输出格式
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// statsInterval 周期性统计快照的间隔
+const statsInterval = 5 * time.Second
+
+// LatencySummary 延迟（或RTT）统计摘要，单位均为纳秒
+type LatencySummary struct {
+	Count  uint64 `json:"count"`
+	MinNs  int64  `json:"min_ns"`
+	AvgNs  int64  `json:"avg_ns"`
+	MaxNs  int64  `json:"max_ns"`
+	P50Ns  int64  `json:"p50_ns"`
+	P90Ns  int64  `json:"p90_ns"`
+	P99Ns  int64  `json:"p99_ns"`
+	P999Ns int64  `json:"p99_9_ns"`
+}
+
+func summarizeLatency(h *LatencyHistogram, total, min, max time.Duration, count int64) LatencySummary {
+	summary := LatencySummary{
+		Count:  uint64(count),
+		MinNs:  int64(min),
+		MaxNs:  int64(max),
+		P50Ns:  int64(h.Percentile(50)),
+		P90Ns:  int64(h.Percentile(90)),
+		P99Ns:  int64(h.Percentile(99)),
+		P999Ns: int64(h.Percentile(99.9)),
+	}
+	if count > 0 {
+		summary.AvgNs = int64(total / time.Duration(count))
+	}
+	return summary
+}
+
+// JitterSummary 抖动统计摘要
+type JitterSummary struct {
+	CurrentNs int64 `json:"current_ns"`
+	MeanNs    int64 `json:"mean_ns"`
+	MaxNs     int64 `json:"max_ns"`
+}
+
+// ServerSnapshot 服务端统计快照
+type ServerSnapshot struct {
+	Received           int64          `json:"received"`
+	Bytes              int64          `json:"bytes"`
+	GoodputBps         float64        `json:"goodput_bps"`
+	WireBps            float64        `json:"wire_bps"`
+	Lost               int64          `json:"lost"`
+	LossRate           float64        `json:"loss_rate"`
+	Reordered          int64          `json:"reordered"`
+	Duplicate          int64          `json:"duplicate"`
+	Stale              int64          `json:"stale"`
+	Malformed          int64          `json:"malformed"`
+	Corrupted          int64          `json:"corrupted"`
+	Untracked          int64          `json:"untracked,omitempty"`
+	MaxReorderDistance uint64         `json:"max_reorder_distance"`
+	MaxReorderExtent   uint64         `json:"max_reorder_extent"`
+	Latency            LatencySummary `json:"latency"`
+	Jitter             JitterSummary  `json:"jitter"`
+}
+
+// Snapshot 生成当前统计的快照
+func (s *ServerStats) Snapshot() ServerSnapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	snap := ServerSnapshot{
+		Received:           s.ReceivedCount,
+		Bytes:              s.ReceivedBytes,
+		Lost:               s.LostCount,
+		Reordered:          s.ReorderedCount,
+		Duplicate:          s.DuplicateCount,
+		Stale:              s.StaleCount,
+		Malformed:          s.MalformedCount,
+		Corrupted:          s.CorruptedCount,
+		Untracked:          s.UntrackedCount,
+		MaxReorderDistance: s.MaxReorderDistance,
+		MaxReorderExtent:   s.MaxReorderExtent,
+		Latency:            summarizeLatency(&s.Histogram, s.TotalLatency, s.MinLatency, s.MaxLatency, s.ReceivedCount),
+		Jitter: JitterSummary{
+			CurrentNs: int64(s.Jitter.Current()),
+			MeanNs:    int64(s.Jitter.Mean()),
+			MaxNs:     int64(s.Jitter.Max()),
+		},
+	}
+	snap.GoodputBps, snap.WireBps = s.throughput()
+	if s.ReceivedCount+s.LostCount > 0 {
+		snap.LossRate = float64(s.LostCount) / float64(s.ReceivedCount+s.LostCount)
+	}
+	return snap
+}
+
+// ClientSnapshot 客户端统计快照
+type ClientSnapshot struct {
+	Sent           int64           `json:"sent"`
+	Errors         int64           `json:"errors"`
+	Bytes          int64           `json:"bytes"`
+	ElapsedNs      int64           `json:"elapsed_ns"`
+	RequestedRate  float64         `json:"requested_rate_pps,omitempty"`
+	Rate           float64         `json:"rate_pps"`
+	GoodputBps     float64         `json:"goodput_bps"`
+	WireBps        float64         `json:"wire_bps"`
+	PacingError    float64         `json:"pacing_error,omitempty"` // (实际速率-请求速率)/请求速率
+	EchoReceived   int64           `json:"echo_received,omitempty"`
+	EchoLost       int64           `json:"echo_lost,omitempty"`
+	DuplicateEchos int64           `json:"duplicate_echos,omitempty"`
+	MalformedEchos int64           `json:"malformed_echos,omitempty"`
+	CorruptedEchos int64           `json:"corrupted_echos,omitempty"`
+	RTT            *LatencySummary `json:"rtt,omitempty"`
+}
+
+// Snapshot 生成当前统计的快照，packetSize 用于计算发送字节数
+func (s *ClientStats) Snapshot(packetSize int) ClientSnapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	elapsed := time.Since(s.StartTime)
+	if !s.EndTime.IsZero() {
+		elapsed = s.EndTime.Sub(s.StartTime)
+	}
+
+	snap := ClientSnapshot{
+		Sent:           s.SentCount,
+		Errors:         s.ErrorCount,
+		Bytes:          s.SentCount * int64(packetSize),
+		ElapsedNs:      int64(elapsed),
+		Rate:           float64(s.SentCount) / elapsed.Seconds(),
+		EchoReceived:   s.EchoCount,
+		EchoLost:       s.echoLost(),
+		DuplicateEchos: s.DuplicateEchos,
+		MalformedEchos: s.MalformedEchos,
+		CorruptedEchos: s.CorruptedEchos,
+	}
+	snap.GoodputBps, snap.WireBps = s.throughput(packetSize, elapsed)
+	if s.RequestedRate > 0 {
+		snap.RequestedRate = s.RequestedRate
+		snap.PacingError = (snap.Rate - s.RequestedRate) / s.RequestedRate
+	}
+	if s.EchoCount > 0 {
+		rtt := summarizeLatency(&s.RTTHistogram, s.TotalRTT, s.MinRTT, s.MaxRTT, s.EchoCount)
+		snap.RTT = &rtt
+	}
+	return snap
+}
+
+// IntervalRecord 周期性快照记录，作为一行JSON输出
+type IntervalRecord struct {
+	Type    string          `json:"type"` // "interval"
+	Role    string          `json:"role"`
+	Mode    string          `json:"mode"`
+	Time    time.Time       `json:"time"`
+	Session string          `json:"session,omitempty"`
+	Client  *ClientSnapshot `json:"client,omitempty"`
+	Server  *ServerSnapshot `json:"server,omitempty"`
+	// Flows 服务端各流的接收统计，只在出现多个流时输出
+	Flows []FlowSnapshot `json:"flows,omitempty"`
+	// Downlink 客户端对服务端下行数据报的接收统计
+	Downlink *ServerSnapshot `json:"downlink,omitempty"`
+}
+
+// ResultDocument 测试结果文档
+type ResultDocument struct {
+	Type      string          `json:"type"` // "result" 或 "session"
+	Role      string          `json:"role"`
+	Mode      string          `json:"mode"`
+	Version   string          `json:"version"`
+	Session   string          `json:"session,omitempty"`
+	StartTime time.Time       `json:"start_time"`
+	EndTime   time.Time       `json:"end_time"`
+	Params    any             `json:"params,omitempty"`
+	Client    *ClientSnapshot `json:"client,omitempty"`
+	Server    *ServerSnapshot `json:"server,omitempty"`
+	// Flows 服务端各流的接收统计，只在出现多个流时输出
+	Flows []FlowSnapshot `json:"flows,omitempty"`
+	// ClientFlows 客户端各流的发送统计
+	ClientFlows []ClientFlowSnapshot `json:"client_flows,omitempty"`
+	// Downlink 客户端对服务端下行数据报的接收统计
+	Downlink *ServerSnapshot `json:"downlink,omitempty"`
+	// DownlinkSender 服务端下行发送统计
+	DownlinkSender *ClientSnapshot `json:"downlink_sender,omitempty"`
+	// SizeProbe 客户端数据报负载尺寸探测结果
+	SizeProbe *SizeProbeResult `json:"size_probe,omitempty"`
+	// Sweep 尺寸/速率矩阵测试的每一步结果
+	Sweep []MeasurementStep `json:"sweep,omitempty"`
+	// Saturation 饱和测试结果
+	Saturation *SaturationResult `json:"saturation,omitempty"`
+	// Interference 数据报与流混合测试结果
+	Interference *InterferenceResult `json:"interference,omitempty"`
+	// Connections 多连接测试中每个连接的结果，此时 Client 为所有连接合并后的发送统计
+	Connections []ConnectionResult `json:"connections,omitempty"`
+	// Compare 传输方式对照测试中每种方式的结果
+	Compare []CompareResult `json:"compare,omitempty"`
+}
+
+// Reporter 负责输出机器可读的JSON记录（每条记录一行），并决定文本信息的输出目标。
+// 在json输出模式下且未指定文件时，JSON写入标准输出，文本信息写入标准错误。
+type Reporter struct {
+	format string
+	w      io.Writer
+	text   io.Writer
+	file   *os.File
+	mutex  sync.Mutex
+}
+
+// NewReporter 根据输出格式和文件路径创建Reporter。
+// 指定了文件路径时，无论输出格式如何都会将JSON记录写入该文件。
+func NewReporter(format, path string) (*Reporter, error) {
+	if format != OutputText && format != OutputJSON {
+		return nil, fmt.Errorf("未知的输出格式: %s (可选 text/json)", format)
+	}
+
+	r := &Reporter{format: format, text: os.Stdout}
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("创建输出文件失败: %w", err)
+		}
+		r.file = file
+		r.w = file
+	} else if format == OutputJSON {
+		r.w = os.Stdout
+		r.text = os.Stderr
+	}
+	return r, nil
+}
+
+// Text 返回文本信息的输出目标，未创建Reporter时为标准输出
+func (r *Reporter) Text() io.Writer {
+	if r == nil {
+		return os.Stdout
+	}
+	return r.text
+}
+
+// Enabled 返回是否需要输出JSON记录
+func (r *Reporter) Enabled() bool {
+	return r != nil && r.w != nil
+}
+
+// Write 将记录编码为一行JSON输出
+func (r *Reporter) Write(record any) {
+	if !r.Enabled() {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := json.NewEncoder(r.w).Encode(record); err != nil {
+		fmt.Fprintf(os.Stderr, "写入JSON记录失败: %v\n", err)
+	}
+}
+
+func (r *Reporter) Close() error {
+	if r == nil || r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// jsonFields 返回一个JSON对象的字段名，按字母排序
+func jsonFields(t *testing.T, data []byte) []string {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("解析JSON失败: %v\n%s", err, data)
+	}
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestReporterJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+	reporter, err := NewReporter(OutputText, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reporter.Enabled() {
+		t.Fatal("指定了输出文件时应写入JSON记录")
+	}
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := ServerSnapshot{Received: 10}
+	client := ClientSnapshot{Sent: 10}
+	records := []struct {
+		name   string
+		record any
+		want   []string
+	}{
+		{"间隔快照", IntervalRecord{Type: "interval", Role: "server", Mode: "native", Time: start, Session: "1", Server: &server},
+			[]string{"mode", "role", "server", "session", "time", "type"}},
+		{"客户端结果", ResultDocument{Type: "result", Role: "client", Mode: "native", Version: Version,
+			StartTime: start, EndTime: start.Add(time.Second), Params: map[string]int{"size": 1200}, Client: &client, Server: &server},
+			[]string{"client", "end_time", "mode", "params", "role", "server", "start_time", "type", "version"}},
+		{"服务端会话", ResultDocument{Type: "session", Role: "server", Mode: "native", Version: Version, Session: "1", StartTime: start, EndTime: start, Server: &server},
+			[]string{"end_time", "mode", "role", "server", "session", "start_time", "type", "version"}},
+		{"尺寸探测", ResultDocument{Type: "result", Role: "client", Mode: "native", Version: Version, StartTime: start, EndTime: start,
+			Client: &client, SizeProbe: &SizeProbeResult{StackLimit: 1452, MaxSize: 1400, Probes: 6}},
+			[]string{"client", "end_time", "mode", "role", "size_probe", "start_time", "type", "version"}},
+	}
+	for _, r := range records {
+		reporter.Write(r.record)
+	}
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	if len(lines) != len(records) {
+		t.Fatalf("输出 %d 行, want %d (每条记录一行)", len(lines), len(records))
+	}
+
+	for i, r := range records {
+		t.Run(r.name, func(t *testing.T) {
+			if got := jsonFields(t, lines[i]); !slices.Equal(got, r.want) {
+				t.Errorf("字段 = %v, want %v", got, r.want)
+			}
+		})
+	}
+}
+
+// TestSnapshotJSONFields 快照中供脚本读取的字段名不能改变，新增字段不影响
+func TestSnapshotJSONFields(t *testing.T) {
+	stats := &ServerStats{}
+	clientStats := &ClientStats{StartTime: time.Now()}
+
+	tests := []struct {
+		name   string
+		record any
+		want   []string
+	}{
+		{"服务端快照", stats.Snapshot(), []string{"duplicate", "jitter", "latency", "loss_rate", "lost", "max_reorder_distance",
+			"max_reorder_extent", "received", "reordered", "stale"}},
+		{"客户端快照", clientStats.Snapshot(1200), []string{"bytes", "elapsed_ns", "errors", "rate_pps", "sent"}},
+		{"延迟摘要", LatencySummary{}, []string{"avg_ns", "count", "max_ns", "min_ns", "p50_ns", "p90_ns", "p99_9_ns", "p99_ns"}},
+		{"抖动摘要", JitterSummary{}, []string{"current_ns", "max_ns", "mean_ns"}},
+		{"尺寸探测结果", SizeProbeResult{Unconfirmed: true}, []string{"max_size", "probes", "stack_limit", "unconfirmed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := jsonFields(t, data)
+			for _, name := range tt.want {
+				if !slices.Contains(got, name) {
+					t.Errorf("缺少字段 %q，实际字段 %v", name, got)
+				}
+			}
+		})
+	}
+}
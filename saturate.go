@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// saturationPrecision 二分查找在上下界相差不足该比例时停止
+const saturationPrecision = 0.02
+
+// SaturationResult 饱和测试结果
+type SaturationResult struct {
+	MaxLoss          float64           `json:"max_loss"`
+	MaxLatencyGrowth time.Duration     `json:"max_latency_growth_ns"`
+	MaxRate          int               `json:"max_rate_pps"` // 满足阈值的最高速率，0表示起始速率即超出阈值
+	MaxGoodputBps    float64           `json:"max_goodput_bps"`
+	Steps            []MeasurementStep `json:"steps"`
+}
+
+// runSaturation 自动提升发送速率，寻找满足丢包和延迟增长阈值的最高速率
+func (c *Client) runSaturation() (SaturationResult, error) {
+	return c.searchSaturation(func(rate int) (MeasurementStep, error) {
+		return c.runMeasurementStep(rate, c.config.PacketSize)
+	})
+}
+
+// searchSaturation 用 measure 测量各速率档位：先从起始速率开始逐档翻倍，
+// 越过阈值后在最后一个合格档位和首个不合格档位之间二分查找。
+// 延迟增长是相对于第一档单向延迟中位数的差值，两端时钟的固定偏差在差值中被抵消。
+func (c *Client) searchSaturation(measure func(rate int) (MeasurementStep, error)) (SaturationResult, error) {
+	result := SaturationResult{
+		MaxLoss:          c.config.MaxLoss,
+		MaxLatencyGrowth: c.config.MaxLatencyGrowth,
+	}
+	// 由 -bitrate 换算的起始速率在解析参数时还未知，在这里再检查一次
+	if c.config.SendRate > c.config.MaxRate {
+		return result, fmt.Errorf("起始速率 %d pps 超过 -max-rate %d pps", c.config.SendRate, c.config.MaxRate)
+	}
+
+	var baseline int64
+	probe := func(rate int) (bool, error) {
+		step, err := measure(rate)
+		if err != nil {
+			return false, err
+		}
+		if len(result.Steps) == 0 {
+			baseline = step.P50Ns
+		}
+		step.LatencyGrowthNs = step.P50Ns - baseline
+		step.OK = step.LossRate*100 <= c.config.MaxLoss &&
+			time.Duration(step.LatencyGrowthNs) <= c.config.MaxLatencyGrowth &&
+			step.AchievedRate >= float64(rate)*(1-saturationPrecision)
+		result.Steps = append(result.Steps, step)
+
+		verdict := "通过"
+		if !step.OK {
+			verdict = "超出阈值"
+		}
+		fmt.Fprintf(c.out, "档位 %d pps: 实际 %.0f pps, 丢包率 %.2f%%, p50 %v, 延迟增长 %v -> %s\n",
+			rate, step.AchievedRate, step.LossRate*100, time.Duration(step.P50Ns),
+			time.Duration(step.LatencyGrowthNs), verdict)
+		if step.OK && rate > result.MaxRate {
+			result.MaxRate = rate
+			result.MaxGoodputBps = step.GoodputBps
+		}
+		return step.OK, nil
+	}
+
+	good, bad := 0, 0
+	for rate := c.config.SendRate; ; rate *= 2 {
+		if rate > c.config.MaxRate {
+			rate = c.config.MaxRate
+		}
+		ok, err := probe(rate)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			bad = rate
+			break
+		}
+		good = rate
+		if rate == c.config.MaxRate {
+			fmt.Fprintf(c.out, "已达到速率上限 %d pps\n", c.config.MaxRate)
+			return result, nil
+		}
+	}
+
+	for i := 0; i < c.config.SaturateIterations && good > 0; i++ {
+		if float64(bad-good) <= float64(good)*saturationPrecision || bad-good <= 1 {
+			break
+		}
+		mid := (good + bad) / 2
+		ok, err := probe(mid)
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			good = mid
+		} else {
+			bad = mid
+		}
+	}
+	return result, nil
+}
+
+// Print 打印速率与丢包/延迟的关系曲线，overhead 为当前模式的每包协议开销
+func (r *SaturationResult) Print(w io.Writer, packetSize, overhead int) {
+	steps := make([]MeasurementStep, len(r.Steps))
+	copy(steps, r.Steps)
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Rate < steps[j].Rate })
+
+	fmt.Fprintf(w, "\n=== 饱和测试结果 (丢包阈值 %.2f%%, 延迟增长阈值 %v) ===\n", r.MaxLoss, r.MaxLatencyGrowth)
+	fmt.Fprintf(w, "%10s %12s %14s %10s %12s %12s %12s  %s\n",
+		"速率(pps)", "实际(pps)", "目标比特率", "丢包率", "p50", "p99", "延迟增长", "结果")
+	for _, step := range steps {
+		verdict := "OK"
+		if !step.OK {
+			verdict = "FAIL"
+		}
+		fmt.Fprintf(w, "%10d %12.0f %14s %9.2f%% %12v %12v %12v  %s\n",
+			step.Rate, step.AchievedRate,
+			FormatBitrate(float64(step.Rate)*float64(packetSize+overhead)*8),
+			step.LossRate*100, time.Duration(step.P50Ns), time.Duration(step.P99Ns),
+			time.Duration(step.LatencyGrowthNs), verdict)
+	}
+
+	if r.MaxRate == 0 {
+		fmt.Fprintf(w, "起始速率即超出阈值，请使用更低的 -rate 重新测试\n")
+	} else {
+		fmt.Fprintf(w, "最高可持续速率: %d pps (接收有效吞吐 %s)\n", r.MaxRate, FormatBitrate(r.MaxGoodputBps))
+	}
+	fmt.Fprintf(w, "==========================================\n")
+}
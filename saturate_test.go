@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// linkModel 模拟容量为 capacity pps 的链路：超出容量的部分全部丢失，延迟增加 overload
+func linkModel(capacity int, overload time.Duration) func(rate int) (MeasurementStep, error) {
+	return func(rate int) (MeasurementStep, error) {
+		step := MeasurementStep{Rate: rate, AchievedRate: float64(rate), P50Ns: int64(time.Millisecond)}
+		if rate > capacity {
+			step.LossRate = float64(rate-capacity) / float64(rate)
+			step.P50Ns += int64(overload)
+		}
+		step.GoodputBps = float64(min(rate, capacity)) * 8 * 1000
+		return step, nil
+	}
+}
+
+func TestSearchSaturation(t *testing.T) {
+	tests := []struct {
+		name      string
+		sendRate  int
+		maxRate   int
+		capacity  int
+		overload  time.Duration
+		wantMin   int // MaxRate 的期望范围
+		wantMax   int
+		wantSteps int // 0表示不检查
+		wantErr   bool
+	}{
+		{"丢包越过阈值后二分查找", 1000, 1000000, 5000, 0, 4900, 5000, 0, false},
+		{"延迟增长越过阈值", 1000, 1000000, 3000, 50 * time.Millisecond, 2940, 3000, 0, false},
+		{"达到速率上限时停止", 1000, 6000, 100000, 0, 6000, 6000, 4, false},
+		{"起始速率即超出阈值", 1000, 1000000, 500, 0, 0, 0, 1, false},
+		{"起始速率超过上限", 2000, 1000, 100000, 0, 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{out: io.Discard, config: ClientConfig{
+				SendRate:           tt.sendRate,
+				MaxRate:            tt.maxRate,
+				MaxLoss:            1,
+				MaxLatencyGrowth:   10 * time.Millisecond,
+				SaturateIterations: 10,
+			}}
+			result, err := c.searchSaturation(linkModel(tt.capacity, tt.overload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.MaxRate < tt.wantMin || result.MaxRate > tt.wantMax {
+				t.Errorf("MaxRate = %d, want %d..%d", result.MaxRate, tt.wantMin, tt.wantMax)
+			}
+			if tt.wantSteps > 0 && len(result.Steps) != tt.wantSteps {
+				t.Errorf("测量了 %d 档, want %d", len(result.Steps), tt.wantSteps)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SendSpec 描述一个数据报发送流
+type SendSpec struct {
+	Rate        int // 包/秒
+	Size        int // 字节
+	Duration    time.Duration
+	PayloadType string
+	FlowID      uint32
+	Flags       byte      // 头部标志位，例如下行数据报的 FlagDownlink 和 FlagChecksum
+	TrackEcho   bool      // 记录发送时间以匹配回显
+	Progress    bool      // 周期性打印发送进度
+	Out         io.Writer // 发送进度和错误的输出目标
+}
+
+// runSender 按 spec 的速率发送测试数据报，直到持续时间结束或ctx被取消
+func runSender(ctx context.Context, conn Connection, spec SendSpec, stats *ClientStats) {
+	pacer := NewPacer(float64(spec.Rate))
+	stats.MarkStart(float64(spec.Rate))
+	defer stats.MarkEnd()
+
+	var seqNum uint64 = 1
+	endTime := time.Now().Add(spec.Duration)
+
+	for {
+		n, err := pacer.Wait(ctx)
+		if err != nil || !time.Now().Before(endTime) {
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			header := Header{Flags: spec.Flags, FlowID: spec.FlowID, Seq: seqNum}
+			payload := GeneratePayload(header, spec.Size, spec.PayloadType)
+
+			// 回显模式下先记录发送时间，避免回显先于记录到达
+			if spec.TrackEcho {
+				stats.TrackSent(seqNum, time.Now())
+			}
+
+			err := conn.SendDatagram(payload)
+			if err != nil {
+				stats.IncrementError()
+				if spec.TrackEcho {
+					stats.Forget(seqNum)
+				}
+				fmt.Fprintf(spec.Out, "发送包 #%d 失败: %v\n", seqNum, err)
+			} else {
+				stats.IncrementSent()
+
+				if spec.Progress && seqNum%progressInterval(spec.Rate) == 0 {
+					fmt.Fprintf(spec.Out, "已发送 %d 个包\n", seqNum)
+				}
+			}
+
+			seqNum++
+		}
+	}
+}
+
+// progressInterval 进度打印间隔：低速率时每100个包打印一次，高速率时约每秒一次
+func progressInterval(rate int) uint64 {
+	if rate > 100 {
+		return uint64(rate)
+	}
+	return 100
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingConn 记录发送的数据报，每 failEvery 个数据报模拟一次发送失败
+type recordingConn struct {
+	mutex     sync.Mutex
+	sent      [][]byte
+	attempts  int
+	failEvery int
+}
+
+func (c *recordingConn) SendDatagram(data []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.attempts++
+	if c.failEvery > 0 && c.attempts%c.failEvery == 0 {
+		return errors.New("模拟发送失败")
+	}
+	c.sent = append(c.sent, append([]byte(nil), data...))
+	return nil
+}
+
+func (c *recordingConn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *recordingConn) OpenStream(ctx context.Context) (Stream, error) {
+	return nil, errStreamsUnsupported
+}
+
+func (c *recordingConn) AcceptStream(ctx context.Context) (Stream, error) {
+	return nil, errStreamsUnsupported
+}
+
+func (c *recordingConn) Close() error       { return nil }
+func (c *recordingConn) RemoteAddr() string { return "test" }
+
+func TestRunSender(t *testing.T) {
+	conn := &recordingConn{failEvery: 4}
+	spec := SendSpec{Rate: 1000, Size: 100, Duration: 100 * time.Millisecond, PayloadType: "sequential",
+		FlowID: 3, Flags: FlagDownlink, TrackEcho: true, Out: io.Discard}
+	var stats ClientStats
+	runSender(context.Background(), conn, spec, &stats)
+
+	if conn.attempts < 50 {
+		t.Fatalf("100ms内只尝试发送 %d 个数据报, want 约100个", conn.attempts)
+	}
+	if stats.SentCount != int64(len(conn.sent)) || stats.ErrorCount != int64(conn.attempts-len(conn.sent)) {
+		t.Errorf("统计 发送 %d, 错误 %d; 实际成功 %d, 失败 %d",
+			stats.SentCount, stats.ErrorCount, len(conn.sent), conn.attempts-len(conn.sent))
+	}
+	// 发送失败的序列号不应计为等待回显
+	if got := stats.echoLost(); got != stats.SentCount {
+		t.Errorf("等待回显 %d 个, want %d", got, stats.SentCount)
+	}
+	if stats.EndTime.IsZero() || stats.RequestedRate != float64(spec.Rate) {
+		t.Errorf("结束时间 %v, 请求速率 %v", stats.EndTime, stats.RequestedRate)
+	}
+
+	var lastSeq uint64
+	for _, data := range conn.sent {
+		header, err := ParseHeader(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != spec.Size || header.FlowID != spec.FlowID || header.Flags&FlagDownlink == 0 {
+			t.Fatalf("数据报 #%d: %d 字节, 流 %d, 标志 %#x", header.Seq, len(data), header.FlowID, header.Flags)
+		}
+		if header.Seq <= lastSeq {
+			t.Fatalf("序列号 %d 不大于前一个 %d", header.Seq, lastSeq)
+		}
+		lastSeq = header.Seq
+	}
+}
+
+func TestRunSenderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var stats ClientStats
+	done := make(chan struct{})
+	go func() {
+		runSender(ctx, &recordingConn{}, SendSpec{Rate: 10, Size: 64, Duration: time.Hour, PayloadType: "random", Out: io.Discard}, &stats)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ctx取消后 runSender 未返回")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+// seqWindowSize 接收跟踪窗口大小（序列号个数），窗口内的迟到包可以被识别为乱序或重复
+const seqWindowSize = 4096
+
+// PacketClass 接收包的分类
+type PacketClass int
+
+const (
+	PacketInOrder   PacketClass = iota // 序列号大于此前最大序列号（可能伴随新的缺口）
+	PacketReordered                    // 迟到但首次到达的包，此前已被计为丢失
+	PacketDuplicate                    // 已经收到过的序列号
+	PacketStale                        // 早于跟踪窗口的迟到包，无法判断是否重复
+)
+
+func (c PacketClass) String() string {
+	switch c {
+	case PacketInOrder:
+		return "in-order"
+	case PacketReordered:
+		return "reordered"
+	case PacketDuplicate:
+		return "duplicate"
+	case PacketStale:
+		return "stale"
+	default:
+		return "unknown"
+	}
+}
+
+// SeqResult 单个包的跟踪结果
+type SeqResult struct {
+	Class PacketClass
+	// Gap 本包之前新出现的缺失序列号个数（仅 PacketInOrder）
+	Gap uint64
+	// Expired 因本包到达而移出窗口、仍未收到的序列号个数，这些包不会再被恢复，确认丢失（仅 PacketInOrder）
+	Expired uint64
+	// Distance 乱序距离：到达时已收到的最大序列号与本包序列号之差（仅 PacketReordered）
+	Distance uint64
+	// Extent 乱序深度 (RFC 4737 reordering extent)：从第一个越过本包的包到达起，
+	// 到本包到达时共经过的到达次数（仅 PacketReordered）
+	Extent uint64
+}
+
+type seqSlot struct {
+	seq       uint64
+	received  bool
+	skipIndex uint64 // 越过该序列号的包的到达序号
+}
+
+// SeqTracker 基于滑动窗口的接收序列跟踪器，区分顺序、乱序、重复和真正丢失的包。
+// 缺口中的序列号先被计为丢失，若在窗口内迟到到达则恢复（RFC 4737）。
+// 非并发安全，由调用方加锁。
+type SeqTracker struct {
+	window   [seqWindowSize]seqSlot
+	highest  uint64
+	arrivals uint64
+}
+
+// Highest 返回已收到的最大序列号
+func (t *SeqTracker) Highest() uint64 {
+	return t.highest
+}
+
+// Track 记录一个到达的序列号并返回其分类。序列号从1开始。
+func (t *SeqTracker) Track(seq uint64) SeqResult {
+	t.arrivals++
+
+	if seq == 0 {
+		return SeqResult{Class: PacketStale}
+	}
+
+	if seq > t.highest {
+		gap := seq - t.highest - 1
+		expired := t.expire(seq)
+
+		// 只需初始化窗口内的序列号，更早的缺口无法再恢复
+		start := t.highest + 1
+		if seq-start >= seqWindowSize {
+			start = seq - seqWindowSize + 1
+		}
+		for s := start; s <= seq; s++ {
+			t.window[s%seqWindowSize] = seqSlot{seq: s, received: s == seq, skipIndex: t.arrivals}
+		}
+
+		t.highest = seq
+		return SeqResult{Class: PacketInOrder, Gap: gap, Expired: expired}
+	}
+
+	if t.highest-seq >= seqWindowSize {
+		return SeqResult{Class: PacketStale}
+	}
+
+	slot := &t.window[seq%seqWindowSize]
+	if slot.seq != seq || slot.received {
+		return SeqResult{Class: PacketDuplicate}
+	}
+
+	slot.received = true
+	return SeqResult{
+		Class:    PacketReordered,
+		Distance: t.highest - seq,
+		Extent:   t.arrivals - slot.skipIndex,
+	}
+}
+
+// expire 统计最大序列号前进到 seq 时移出窗口的缺失序列号，包括从未进入过窗口的缺口
+func (t *SeqTracker) expire(seq uint64) uint64 {
+	if seq <= seqWindowSize {
+		return 0
+	}
+	limit := seq - seqWindowSize // 新窗口之前的最大序列号
+
+	var expired uint64
+	from := uint64(1)
+	if t.highest >= seqWindowSize {
+		from = t.highest - seqWindowSize + 1
+	}
+	for s := from; s <= min(limit, t.highest); s++ {
+		if slot := t.window[s%seqWindowSize]; slot.seq == s && !slot.received {
+			expired++
+		}
+	}
+	if limit > t.highest {
+		expired += limit - t.highest
+	}
+	return expired
+}
@@ -0,0 +1,115 @@
+package main
+
+import "testing"
+
+func TestSeqTracker(t *testing.T) {
+	type step struct {
+		seq  uint64
+		want SeqResult
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"顺序到达", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{2, SeqResult{Class: PacketInOrder}},
+			{3, SeqResult{Class: PacketInOrder}},
+		}},
+		{"缺口", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{4, SeqResult{Class: PacketInOrder, Gap: 2}},
+		}},
+		{"乱序恢复缺口", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{3, SeqResult{Class: PacketInOrder, Gap: 1}},
+			{4, SeqResult{Class: PacketInOrder}},
+			{2, SeqResult{Class: PacketReordered, Distance: 2, Extent: 2}},
+		}},
+		{"重复", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{2, SeqResult{Class: PacketInOrder}},
+			{2, SeqResult{Class: PacketDuplicate}},
+			{1, SeqResult{Class: PacketDuplicate}},
+		}},
+		{"乱序包再次到达为重复", []step{
+			{2, SeqResult{Class: PacketInOrder, Gap: 1}},
+			{1, SeqResult{Class: PacketReordered, Distance: 1, Extent: 1}},
+			{1, SeqResult{Class: PacketDuplicate}},
+		}},
+		{"序列号0", []step{
+			{0, SeqResult{Class: PacketStale}},
+		}},
+		{"窗口边缘仍可恢复", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{seqWindowSize + 1, SeqResult{Class: PacketInOrder, Gap: seqWindowSize - 1}},
+			{2, SeqResult{Class: PacketReordered, Distance: seqWindowSize - 1, Extent: 1}},
+		}},
+		{"越过窗口的迟到包", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{5000, SeqResult{Class: PacketInOrder, Gap: 4998, Expired: 5000 - seqWindowSize - 1}},
+			{1, SeqResult{Class: PacketStale}},
+			{5000 - seqWindowSize, SeqResult{Class: PacketStale}},
+			{5000 - seqWindowSize + 1, SeqResult{Class: PacketReordered, Distance: seqWindowSize - 1, Extent: 3}},
+		}},
+		{"缺失的包移出窗口后确认丢失", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{3, SeqResult{Class: PacketInOrder, Gap: 1}},
+			{seqWindowSize + 1, SeqResult{Class: PacketInOrder, Gap: seqWindowSize - 3}},
+			{seqWindowSize + 2, SeqResult{Class: PacketInOrder, Expired: 1}},
+			{2, SeqResult{Class: PacketStale}},
+		}},
+		{"恢复的包移出窗口时不计丢失", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{3, SeqResult{Class: PacketInOrder, Gap: 1}},
+			{2, SeqResult{Class: PacketReordered, Distance: 1, Extent: 1}},
+			{seqWindowSize + 3, SeqResult{Class: PacketInOrder, Gap: seqWindowSize - 1}},
+		}},
+		{"窗口槽位复用后的旧序列号", []step{
+			{1, SeqResult{Class: PacketInOrder}},
+			{2, SeqResult{Class: PacketInOrder}},
+			{seqWindowSize + 2, SeqResult{Class: PacketInOrder, Gap: seqWindowSize - 1}},
+			// 槽位 2%4096 已被 4098 覆盖，2 早于窗口
+			{2, SeqResult{Class: PacketStale}},
+			{seqWindowSize + 2, SeqResult{Class: PacketDuplicate}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracker SeqTracker
+			for i, s := range tt.steps {
+				if got := tracker.Track(s.seq); got != s.want {
+					t.Fatalf("第 %d 步 Track(%d) = %+v, want %+v", i+1, s.seq, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSeqTrackerWrapInOrder(t *testing.T) {
+	// 顺序收到多倍窗口长度的序列号，之后窗口内的旧包都是重复，窗口外的是过期
+	var tracker SeqTracker
+	const n = 3*seqWindowSize + 17
+	for seq := uint64(1); seq <= n; seq++ {
+		if got := tracker.Track(seq); got.Class != PacketInOrder || got.Gap != 0 {
+			t.Fatalf("Track(%d) = %+v", seq, got)
+		}
+	}
+	if tracker.Highest() != n {
+		t.Fatalf("Highest() = %d, want %d", tracker.Highest(), n)
+	}
+	for _, tt := range []struct {
+		seq  uint64
+		want PacketClass
+	}{
+		{n, PacketDuplicate},
+		{n - seqWindowSize + 1, PacketDuplicate},
+		{n - seqWindowSize, PacketStale},
+		{1, PacketStale},
+	} {
+		if got := tracker.Track(tt.seq); got.Class != tt.want {
+			t.Errorf("Track(%d) = %v, want %v", tt.seq, got.Class, tt.want)
+		}
+	}
+}
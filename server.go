@@ -1,17 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
@@ -19,11 +31,230 @@ import (
 	tpt "github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 )
 
+// ServerConfig 服务端配置
+type ServerConfig struct {
+	Mode       string `json:"mode"`
+	Addr       string `json:"addr,omitempty"`       // native、stream、webtransport、h3、udp和masque模式的监听地址
+	UDPAddr    string `json:"udp_addr,omitempty"`   // native模式下额外监听裸UDP的地址，用于同一服务端上的对照测试
+	ListenAddr string `json:"listen,omitempty"`     // libp2p模式监听的multiaddr
+	Rendezvous string `json:"rendezvous,omitempty"` // libp2p模式在DHT中登记的rendezvous命名空间，为空时不登记
+	DHT        bool   `json:"dht,omitempty"`        // 没有bootstrap节点时也应答DHT查询，作为其他节点的bootstrap节点
+	MDNS       bool   `json:"mdns,omitempty"`       // libp2p模式通过mDNS在局域网内通告本节点
+	Echo       bool   `json:"echo"`                 // 将收到的数据报原样回显给客户端
+	Metrics    string `json:"metrics,omitempty"`    // Prometheus指标HTTP监听地址，为空时不启用
+	Output     string `json:"-"`
+	OutputFile string `json:"-"`
+	Verbose    bool   `json:"-"` // 逐包输出收到的数据报
+}
+
 type Server struct {
-	stats ServerStats
-	mode  string
+	config    ServerConfig
+	reporter  *Reporter
+	out       io.Writer // 文本信息的输出目标
+	startTime time.Time
+
+	sessions map[string]*Session // 活跃会话，按远端地址或Peer ID索引
+	finished ServerStats         // 已结束会话的累计统计
+	closed   int                 // 已结束会话数
+
+	// Prometheus计数器的累计值：会话结束或重置时，旧的统计记录按会话和流并入 retired，
+	// 与活跃会话相加后只增不减；retiredOrder 记录各组的加入顺序，超出上限时淘汰最早的一组
+	retired      map[metricKey]*metricTotals
+	retiredOrder []metricKey
+	accepted     map[string]int // 按传输方式累计接受的连接数
+	mutex        sync.Mutex
+}
+
+// Session 表示一个客户端连接及其独立的统计记录
+type Session struct {
+	ID         string
+	RemoteAddr string
+	Mode       string // 连接实际使用的传输方式，native服务端上可能是stream、webtransport、h3或udp
+	StartTime  time.Time
+
+	// 当前按流分开的统计记录，客户端请求重置时整体替换
+	flows atomic.Pointer[FlowSet]
+
+	// 下行（服务端到客户端）发送统计
+	Downlink        ClientStats
+	downlinkStarted bool
+	downlinkSize    int
+
+	resetEpoch uint64 // 最近一次生效的统计重置请求
+
+	// 通过控制流协商的测试状态
+	params     atomic.Pointer[TestParams]
+	controlled atomic.Bool // 客户端打开了控制流
+	testing    atomic.Bool // 处于 start 和 stop 之间
+	testStart  time.Time   // 只在控制流协程中访问
+
+	// 批量数据流的累计接收字节数和当前流数
+	bulkBytes   atomic.Int64
+	bulkStreams atomic.Int32
+}
+
+func NewServer(config ServerConfig, reporter *Reporter) *Server {
+	return &Server{
+		config:    config,
+		reporter:  reporter,
+		out:       reporter.Text(),
+		startTime: time.Now(),
+		sessions:  make(map[string]*Session),
+		retired:   make(map[metricKey]*metricTotals),
+		accepted:  make(map[string]int),
+	}
+}
+
+// openSession 为新连接创建统计记录，同一地址的多个连接会追加序号区分
+func (s *Server) openSession(remoteAddr, mode string) *Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := remoteAddr
+	for i := 2; s.sessions[id] != nil; i++ {
+		id = fmt.Sprintf("%s#%d", remoteAddr, i)
+	}
+
+	session := &Session{ID: id, RemoteAddr: remoteAddr, Mode: mode, StartTime: time.Now()}
+	session.flows.Store(NewFlowSet(wireOverhead(mode)))
+	session.Downlink.overhead = wireOverhead(mode)
+	s.sessions[id] = session
+	s.accepted[mode]++
+	return session
+}
+
+// sessionMode 返回连接实际使用的传输方式，libp2p连接使用服务端的模式
+func (s *Server) sessionMode(conn Connection) string {
+	switch conn.(type) {
+	case *NativeConnection:
+		return "native"
+	case *StreamConnection:
+		return "stream"
+	case *WebTransportConnection:
+		return "webtransport"
+	case *HTTPDatagramConnection:
+		return "h3"
+	case *UDPConnection:
+		return "udp"
+	}
+	return s.config.Mode
+}
+
+// Flows 返回会话当前按流分开的统计记录
+func (s *Session) Flows() *FlowSet {
+	return s.flows.Load()
+}
+
+// Stats 返回会话所有流合并后的统计记录副本
+func (s *Session) Stats() *ServerStats {
+	return s.Flows().Total()
+}
+
+// flowSnapshots 返回会话各流的快照，只有一个流时返回 nil，避免与会话统计重复
+func (s *Session) flowSnapshots() []FlowSnapshot {
+	if s.Flows().Len() <= 1 {
+		return nil
+	}
+	return s.Flows().Snapshots()
+}
+
+// resetSession 以新的统计记录替换会话当前记录，旧记录并入累计统计，保证汇总视图不丢失数据
+func (s *Server) resetSession(session *Session) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := session.flows.Swap(NewFlowSet(wireOverhead(session.Mode)))
+	s.finished.MergeFrom(old.Total())
+	s.retireFlows(session, old)
+}
+
+// retireFlows 将会话不再更新的统计记录并入累计指标，调用方需持有 s.mutex
+func (s *Server) retireFlows(session *Session, flows *FlowSet) {
+	totals := make(map[metricKey]*metricTotals)
+	addFlows(totals, session.Mode, session.ID, flows, true)
+	for key, t := range totals {
+		retired := s.retired[key]
+		if retired == nil {
+			if len(s.retiredOrder) >= maxRetiredSeries {
+				delete(s.retired, s.retiredOrder[0])
+				s.retiredOrder = s.retiredOrder[1:]
+			}
+			retired = newMetricTotals()
+			s.retired[key] = retired
+			s.retiredOrder = append(s.retiredOrder, key)
+		}
+		retired.merge(t)
+	}
+}
+
+// closeSession 打印会话的最终统计，并将其并入已结束会话的累计统计
+func (s *Server) closeSession(session *Session) {
+	stats := session.Stats()
+	flows := session.flowSnapshots()
+	stats.PrintFinal(s.out, fmt.Sprintf("会话结束 %s (持续 %v)", session.ID, time.Since(session.StartTime).Round(time.Millisecond)))
+	if flows != nil {
+		PrintFlowTable(s.out, "会话 "+session.ID+" 各流统计", flows, nil)
+	}
+	if bulk := session.bulkBytes.Load(); bulk > 0 {
+		fmt.Fprintf(s.out, "批量数据流累计接收: %.2f MB\n", float64(bulk)/1024/1024)
+	}
+
+	if s.reporter.Enabled() {
+		snap := stats.Snapshot()
+		doc := ResultDocument{
+			Type:      "session",
+			Role:      "server",
+			Mode:      session.Mode,
+			Version:   Version,
+			Session:   session.ID,
+			StartTime: session.StartTime,
+			EndTime:   time.Now(),
+			Server:    &snap,
+			Flows:     flows,
+		}
+		if session.downlinkStarted {
+			downSnap := session.Downlink.Snapshot(session.downlinkSize)
+			doc.DownlinkSender = &downSnap
+		}
+		s.reporter.Write(doc)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, session.ID)
+	s.closed++
+	s.finished.MergeFrom(stats)
+	s.retireFlows(session, session.Flows())
+}
+
+// activeSessions 返回按ID排序的活跃会话列表
+func (s *Server) activeSessions() []*Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// aggregate 汇总所有已结束和活跃会话的统计，同时返回活跃和已结束的会话数
+func (s *Server) aggregate() (total *ServerStats, active, closed int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	total = &ServerStats{}
+	total.MergeFrom(&s.finished)
+	for _, session := range s.sessions {
+		total.MergeFrom(session.Stats())
+	}
+	return total, len(s.sessions), s.closed
 }
 
 func generateTLSConfig() *tls.Config {
@@ -54,37 +285,347 @@ func generateTLSConfig() *tls.Config {
 			Certificate: [][]byte{certDER},
 			PrivateKey:  key,
 		}},
-		NextProtos: []string{"quic-datagram-test"},
+		NextProtos: []string{"quic-datagram-test", streamModeALPN, http3.NextProtoH3},
 	}
 }
 
 func (s *Server) handleConnection(conn Connection) {
-	fmt.Printf("客户端连接: %s\n", conn.RemoteAddr())
+	fmt.Fprintf(s.out, "客户端连接: %s\n", conn.RemoteAddr())
+
+	session := s.openSession(conn.RemoteAddr(), s.sessionMode(conn))
+	defer s.closeSession(session)
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.serveStreams(ctx, conn, session)
 
 	for {
 		data, err := conn.ReceiveDatagram(ctx)
 		if err != nil {
-			fmt.Printf("接收数据报错误: %v\n", err)
+			fmt.Fprintf(s.out, "接收数据报错误: %v\n", err)
+			return
+		}
+
+		if IsControl(data) {
+			s.handleControl(ctx, conn, session, data)
+			continue
+		}
+
+		// 先回显再统计，尽量减少回显引入的额外时延
+		if s.config.Echo {
+			if err := conn.SendDatagram(data); err != nil {
+				fmt.Fprintf(s.out, "回显数据报错误: %v\n", err)
+			}
+		}
+
+		session.Flows().ProcessPacket(data, s.out, s.config.Verbose)
+	}
+}
+
+// handleControl 处理客户端发来的控制数据报
+func (s *Server) handleControl(ctx context.Context, conn Connection, session *Session, data []byte) {
+	msgType, body, err := DecodeControl(data)
+	if err != nil {
+		fmt.Fprintf(s.out, "解析控制消息失败: %v\n", err)
+		return
+	}
+
+	switch msgType {
+	case ControlDownlinkRequest:
+		var req DownlinkRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			fmt.Fprintf(s.out, "解析下行请求失败: %v\n", err)
+			return
+		}
+
+		// 客户端会重发请求直到收到确认，重复的请求只回复确认
+		if !session.downlinkStarted && req.Rate > 0 && req.Size >= HeaderLen && req.Size <= MaxPacketSize {
+			session.downlinkStarted = true
+			session.downlinkSize = req.Size
+			// 在发送协程启动前设置，之后只由发送协程在锁内更新，会话结束时读取快照不会竞争
+			session.Downlink.StartTime = time.Now()
+			fmt.Fprintf(s.out, "会话 %s 开始下行发送: %d pps, %d 字节, 持续 %v\n",
+				session.ID, req.Rate, req.Size, req.Duration)
+			go s.sendDownlink(ctx, conn, session, req)
+		}
+
+		s.replyControl(conn, ControlDownlinkAck, req)
+	case ControlStatsReset:
+		var req StatsResetRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			fmt.Fprintf(s.out, "解析重置请求失败: %v\n", err)
+			return
+		}
+
+		if req.Epoch != session.resetEpoch {
+			session.resetEpoch = req.Epoch
+			s.resetSession(session)
+		}
+		s.replyControl(conn, ControlStatsResetAck, req)
+	case ControlStatsRequest:
+		var req ControlHeader
+		if err := json.Unmarshal(body, &req); err != nil {
+			fmt.Fprintf(s.out, "解析统计请求失败: %v\n", err)
+			return
+		}
+		s.replyControl(conn, ControlStatsReport, StatsReport{
+			ControlHeader: req,
+			Stats:         session.Stats().Snapshot(),
+			BulkBytes:     session.bulkBytes.Load(),
+		})
+	case ControlSizeProbe:
+		var req SizeProbe
+		if err := json.Unmarshal(body, &req); err != nil {
+			fmt.Fprintf(s.out, "解析尺寸探测失败: %v\n", err)
+			return
+		}
+		// 确认消息本身很小，只回传收到的长度，避免受下行方向的尺寸限制
+		s.replyControl(conn, ControlSizeProbeAck, SizeProbeAck{ControlHeader: req.ControlHeader, Received: len(data)})
+	default:
+		fmt.Fprintf(s.out, "未知的控制消息类型: %v\n", msgType)
+	}
+}
+
+// serveStreams 接受客户端打开的可靠流，直到连接结束。
+// 以 bulkStreamPreface 开头的是批量数据流，只读取并计数；其余的作为控制流处理。
+func (s *Server) serveStreams(ctx context.Context, conn Connection, session *Session) {
+	for {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		go s.serveStream(ctx, stream, session)
+	}
+}
+
+// serveStream 根据流开头的前缀区分批量数据流和控制流
+func (s *Server) serveStream(ctx context.Context, stream Stream, session *Session) {
+	reader := bufio.NewReader(stream)
+	if prefix, err := reader.Peek(len(bulkStreamPreface)); err == nil && string(prefix) == bulkStreamPreface {
+		reader.Discard(len(bulkStreamPreface))
+		s.drainBulkStream(ctx, reader, session)
+		stream.Close()
+		return
+	}
+	s.serveControlStream(ctx, &bufferedStream{Stream: stream, reader: reader}, session)
+}
+
+// serveControlStream 在控制流上逐条应答客户端的请求，直到流或连接关闭
+func (s *Server) serveControlStream(ctx context.Context, stream Stream, session *Session) {
+	control := NewControlStream(stream)
+	defer control.Close()
+	session.controlled.Store(true)
+
+	for {
+		msg, err := control.Receive(0)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				fmt.Fprintf(s.out, "会话 %s 控制流错误: %v\n", session.ID, err)
+			}
+			return
+		}
+
+		if err := control.Send(s.handleStreamMessage(session, msg)); err != nil {
+			fmt.Fprintf(s.out, "会话 %s %v\n", session.ID, err)
 			return
 		}
+	}
+}
+
+// handleStreamMessage 处理一条控制流请求，返回应答
+func (s *Server) handleStreamMessage(session *Session, msg StreamMessage) StreamMessage {
+	switch msg.Type {
+	case StreamParams:
+		if msg.Params == nil {
+			return StreamMessage{Type: StreamError, Error: "缺少测试参数"}
+		}
+		session.params.Store(msg.Params)
+		if len(msg.Params.Flows) > 0 {
+			fmt.Fprintf(s.out, "会话 %s 测试参数: 模式 %s, %d 个并发流, 持续 %v, 回显 %v\n",
+				session.ID, msg.Params.Mode, len(msg.Params.Flows), msg.Params.Duration, msg.Params.Echo)
+			for _, flow := range msg.Params.Flows {
+				fmt.Fprintf(s.out, "  流 %d: %d pps, %d 字节, 负载 %s\n", flow.ID, flow.Rate, flow.Size, flow.PayloadType)
+			}
+		} else {
+			fmt.Fprintf(s.out, "会话 %s 测试参数: 模式 %s, 包大小 %d 字节, 速率 %d pps, 持续 %v, 负载 %s, 回显 %v\n",
+				session.ID, msg.Params.Mode, msg.Params.PacketSize, msg.Params.SendRate,
+				msg.Params.Duration, msg.Params.PayloadType, msg.Params.Echo)
+		}
+		return StreamMessage{Type: StreamReady}
+	case StreamStart:
+		s.resetSession(session)
+		session.testStart = time.Now()
+		session.testing.Store(true)
+		fmt.Fprintf(s.out, "会话 %s 测试开始\n", session.ID)
+		return StreamMessage{Type: StreamStarted}
+	case StreamStop:
+		if !session.testing.Swap(false) {
+			return StreamMessage{Type: StreamError, Error: "测试未开始"}
+		}
+		stats := session.Stats()
+		flows := session.flowSnapshots()
+		stats.PrintFinal(s.out, fmt.Sprintf("会话 %s 测试结果", session.ID))
+		snap := stats.Snapshot()
+		if flows != nil {
+			PrintFlowTable(s.out, fmt.Sprintf("会话 %s 各流测试结果", session.ID), flows, msg.FlowSent)
+		}
+		s.printVerdict(session, msg.Sent, snap)
 
-		s.stats.ProcessPacket(data)
+		if s.reporter.Enabled() {
+			s.reporter.Write(ResultDocument{
+				Type:      "test",
+				Role:      "server",
+				Mode:      session.Mode,
+				Version:   Version,
+				Session:   session.ID,
+				StartTime: session.testStart,
+				EndTime:   time.Now(),
+				Params:    session.params.Load(),
+				Server:    &snap,
+				Flows:     flows,
+			})
+		}
+		return StreamMessage{Type: StreamResult, Stats: &snap, Flows: flows}
+	default:
+		return StreamMessage{Type: StreamError, Error: fmt.Sprintf("未知的控制流消息类型 %q", msg.Type)}
 	}
 }
 
+// printVerdict 根据客户端报告的发送数和声明的参数给出本次测试的结论
+func (s *Server) printVerdict(session *Session, sent int64, snap ServerSnapshot) {
+	fmt.Fprintf(s.out, "--- 会话 %s 测试结论 ---\n", session.ID)
+	if sent > 0 {
+		missing := sent - snap.Received
+		if missing < 0 {
+			missing = 0
+		}
+		fmt.Fprintf(s.out, "客户端发送 %d, 服务端接收 %d, 端到端丢包 %d (%.2f%%)\n",
+			sent, snap.Received, missing, float64(missing)/float64(sent)*100)
+	}
+	if params := session.params.Load(); params != nil && params.Duration > 0 {
+		rate := params.SendRate
+		if len(params.Flows) > 0 {
+			rate = 0
+			for _, flow := range params.Flows {
+				rate += flow.Rate
+			}
+		}
+		expected := int64(float64(rate) * params.Duration.Seconds())
+		if sent > 0 && float64(sent) < float64(expected)*0.95 {
+			fmt.Fprintf(s.out, "客户端只发送了预期 %d 个包中的 %d 个，未达到声明的速率\n", expected, sent)
+		}
+	}
+}
+
+// replyControl 向客户端发送控制响应
+func (s *Server) replyControl(conn Connection, msgType ControlType, msg any) {
+	data, err := EncodeControl(msgType, msg)
+	if err != nil {
+		fmt.Fprintf(s.out, "%v\n", err)
+		return
+	}
+	if err := conn.SendDatagram(data); err != nil {
+		fmt.Fprintf(s.out, "发送控制响应 %v 失败: %v\n", msgType, err)
+	}
+}
+
+// sendDownlink 按客户端请求的速率和大小向客户端发送测试数据报
+func (s *Server) sendDownlink(ctx context.Context, conn Connection, session *Session, req DownlinkRequest) {
+	flags := FlagDownlink
+	if req.Checksum {
+		flags |= FlagChecksum
+	}
+
+	runSender(ctx, conn, SendSpec{
+		Rate:        req.Rate,
+		Size:        req.Size,
+		Duration:    req.Duration,
+		PayloadType: req.PayloadType,
+		Flags:       flags,
+		Out:         s.out,
+	}, &session.Downlink)
+	session.Downlink.MarkEnd()
+
+	fmt.Fprintf(s.out, "会话 %s 下行发送结束\n", session.ID)
+	session.Downlink.PrintFinal(s.out, "会话 "+session.ID+" 下行发送统计", req.Size)
+}
+
 func (s *Server) printStats() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		s.stats.Print()
+	for now := range ticker.C {
+		printed := 0
+		for _, session := range s.activeSessions() {
+			// 使用控制流的会话只在测试进行中打印
+			if session.controlled.Load() && !session.testing.Load() {
+				continue
+			}
+			printed++
+			stats := session.Stats()
+			flows := session.flowSnapshots()
+			stats.Print(s.out, "会话 "+session.ID)
+			if flows != nil {
+				PrintFlowTable(s.out, "会话 "+session.ID+" 各流统计", flows, nil)
+			}
+			if s.reporter.Enabled() {
+				snap := stats.Snapshot()
+				s.reporter.Write(IntervalRecord{Type: "interval", Role: "server", Mode: session.Mode, Time: now, Session: session.ID, Server: &snap, Flows: flows})
+			}
+		}
+
+		// 没有进行中的测试时保持安静
+		if printed == 0 {
+			continue
+		}
+
+		total, active, closed := s.aggregate()
+		total.Print(s.out, fmt.Sprintf("汇总统计 (活跃 %d, 已结束 %d)", active, closed))
+		if s.reporter.Enabled() {
+			snap := total.Snapshot()
+			s.reporter.Write(IntervalRecord{Type: "interval", Role: "server", Mode: s.config.Mode, Time: now, Server: &snap})
+		}
+	}
+}
+
+// printFinalOnExit 在收到中断信号时打印汇总的最终报告并退出
+func (s *Server) printFinalOnExit() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+
+	total, active, closed := s.aggregate()
+	total.PrintFinal(s.out, fmt.Sprintf("最终汇总统计 (活跃 %d, 已结束 %d)", active, closed))
+
+	if s.reporter.Enabled() {
+		snap := total.Snapshot()
+		s.reporter.Write(ResultDocument{
+			Type:      "result",
+			Role:      "server",
+			Mode:      s.config.Mode,
+			Version:   Version,
+			StartTime: s.startTime,
+			EndTime:   time.Now(),
+			Params:    s.config,
+			Server:    &snap,
+		})
+	}
+	s.reporter.Close()
+	os.Exit(0)
+}
+
+// startBackground 启动周期统计、退出时的最终报告以及可选的指标服务
+func (s *Server) startBackground() {
+	go s.printStats()
+	go s.printFinalOnExit()
+	if s.config.Metrics != "" {
+		go s.serveMetrics(s.config.Metrics)
 	}
 }
 
-func runNativeServer(addr string) error {
-	listener, err := quic.ListenAddr(addr, generateTLSConfig(), &quic.Config{
+func runNativeServer(config ServerConfig, reporter *Reporter) error {
+	listener, err := quic.ListenAddr(config.Addr, generateTLSConfig(), &quic.Config{
 		EnableDatagrams: true,
 	})
 	if err != nil {
@@ -92,10 +633,30 @@ func runNativeServer(addr string) error {
 	}
 	defer listener.Close()
 
-	server := &Server{mode: "native"}
-	fmt.Printf("Native QUIC Datagram 服务器启动，监听地址: %s\n", addr)
+	server := NewServer(config, reporter)
+	fmt.Fprintf(server.out, "Native QUIC Datagram 服务器启动，监听地址: %s (同时接受stream、webtransport和h3模式)\n", config.Addr)
+	fmt.Fprintf(server.out, "WebTransport地址: https://%s%s\n", config.Addr, webTransportPath)
+
+	if config.UDPAddr != "" {
+		socket, err := listenUDP(config.UDPAddr)
+		if err != nil {
+			return err
+		}
+		defer socket.Close()
+		fmt.Fprintf(server.out, "裸UDP对照监听地址: %s\n", config.UDPAddr)
+		go func() {
+			if err := server.serveUDP(socket); err != nil {
+				log.Printf("裸UDP接收错误: %v", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(h3DatagramPath, server.serveHTTPDatagram)
+	wt := newWebTransportServer(server, mux)
+	defer wt.Close()
 
-	go server.printStats()
+	server.startBackground()
 
 	for {
 		conn, err := listener.Accept(context.Background())
@@ -104,12 +665,40 @@ func runNativeServer(addr string) error {
 			continue
 		}
 
+		// 按ALPN区分连接类型，HTTP/3连接交给WebTransport服务端
+		switch conn.ConnectionState().TLS.NegotiatedProtocol {
+		case streamModeALPN:
+			go server.handleStreamModeConnection(conn)
+			continue
+		case http3.NextProtoH3:
+			go wt.ServeQUICConn(conn)
+			continue
+		}
+
 		nativeConn := &NativeConnection{conn: conn}
 		go server.handleConnection(nativeConn)
 	}
 }
 
-func makeDatagramTransport(config *Config) (tpt.Transport, error) {
+// handleStreamModeConnection 接受stream模式连接的消息流，之后与数据报连接同样处理
+func (s *Server) handleStreamModeConnection(conn *quic.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), controlStreamTimeout)
+	defer cancel()
+
+	streamConn, err := acceptStreamConnection(ctx, conn)
+	if err != nil {
+		fmt.Fprintf(s.out, "stream模式连接 %s 失败: %v\n", conn.RemoteAddr(), err)
+		conn.CloseWithError(0, "")
+		return
+	}
+	s.handleConnection(streamConn)
+}
+
+// makeDatagramTransport 按模式创建支持datagram的transport：libp2p使用QUIC，libp2p-webrtc使用webrtc-direct
+func makeDatagramTransport(mode string, config *Config) (tpt.Transport, error) {
+	if mode == "libp2p-webrtc" {
+		return NewWebRTCDatagramTransport(config.PrivateKey)
+	}
 	var resetKey quic.StatelessResetKey
 	var tokenKey quic.TokenGeneratorKey
 	connManager, err := quicreuse.NewConnManager(resetKey, tokenKey)
@@ -119,8 +708,8 @@ func makeDatagramTransport(config *Config) (tpt.Transport, error) {
 	return NewDatagramTransport(config.PrivateKey, connManager, nil, nil, nil)
 }
 
-func runLibP2PServer(listenAddr string, config *Config) error {
-	transport, err := makeDatagramTransport(config)
+func runLibP2PServer(serverConfig ServerConfig, config *Config, reporter *Reporter) error {
+	transport, err := makeDatagramTransport(serverConfig.Mode, config)
 	if err != nil {
 		return fmt.Errorf("创建transport失败: %w", err)
 	}
@@ -128,7 +717,7 @@ func runLibP2PServer(listenAddr string, config *Config) error {
 	h, err := libp2p.New(
 		libp2p.Identity(config.PrivateKey),
 		libp2p.Transport(func() (tpt.Transport, error) { return transport, nil }),
-		libp2p.ListenAddrStrings(listenAddr),
+		libp2p.ListenAddrStrings(serverConfig.ListenAddr),
 		libp2p.DisableRelay(),
 	)
 	if err != nil {
@@ -136,50 +725,121 @@ func runLibP2PServer(listenAddr string, config *Config) error {
 	}
 	defer h.Close()
 
-	server := &Server{mode: "libp2p"}
-	
-	fmt.Printf("LibP2P QUIC Datagram 服务器启动\n")
-	fmt.Printf("Peer ID: %s\n", h.ID())
-	fmt.Printf("监听地址:\n")
+	server := NewServer(serverConfig, reporter)
+
+	if serverConfig.Mode == "libp2p-webrtc" {
+		fmt.Fprintf(server.out, "LibP2P WebRTC-direct Datagram 服务器启动\n")
+	} else {
+		fmt.Fprintf(server.out, "LibP2P QUIC Datagram 服务器启动\n")
+	}
+	fmt.Fprintf(server.out, "Peer ID: %s\n", h.ID())
+	fmt.Fprintf(server.out, "监听地址:\n")
 	for _, addr := range h.Addrs() {
-		fmt.Printf("  %s/p2p/%s\n", addr, h.ID())
+		fmt.Fprintf(server.out, "  %s/p2p/%s\n", addr, h.ID())
+	}
+
+	// 配置了bootstrap节点时加入DHT，连接成功后在rendezvous命名空间下登记自己；
+	// 没有bootstrap节点时只在 -dht 下应答其他节点的查询，不登记
+	if len(config.BootstrapNodes) > 0 || serverConfig.DHT {
+		kad, err := newDHT(context.Background(), h, true)
+		if err != nil {
+			return fmt.Errorf("启动DHT失败: %w", err)
+		}
+		defer kad.Close()
+		connected := 0
+		if len(config.BootstrapNodes) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), dhtLookupTimeout)
+			connected = joinDHT(ctx, kad, config.BootstrapNodes, server.out)
+			cancel()
+			fmt.Fprintf(server.out, "已连接 %d/%d 个bootstrap节点\n", connected, len(config.BootstrapNodes))
+		}
+		if connected > 0 && serverConfig.Rendezvous != "" {
+			go advertise(context.Background(), kad, serverConfig.Rendezvous, server.out)
+		}
 	}
 
-	// 设置连接通知器
+	if serverConfig.MDNS {
+		service, err := startMDNS(h)
+		if err != nil {
+			return fmt.Errorf("启动mDNS失败: %w", err)
+		}
+		defer service.Close()
+		fmt.Fprintf(server.out, "已通过mDNS在局域网内通告本节点 (服务名 %s)\n", mdnsServiceName)
+	}
+
+	// 设置连接通知器，控制流经由 router 交给对应的连接
+	router := newStreamRouter(h)
 	notifee := &network.NotifyBundle{
 		ConnectedF: func(n network.Network, conn network.Conn) {
-			fmt.Printf("新连接来自: %s\n", conn.RemotePeer())
-			libp2pConn, err := NewLibP2PConnection(conn)
+			libp2pConn, err := router.connection(conn)
 			if err != nil {
-				fmt.Printf("创建LibP2P连接失败: %v\n", err)
+				fmt.Fprintf(server.out, "创建LibP2P连接失败: %v\n", err)
 				return
 			}
-			go server.handleConnection(libp2pConn)
+			// 只用于DHT查询的连接（bootstrap节点、其他服务端）不作为测试会话
+			go func() {
+				if libp2pConn.awaitTraffic() {
+					fmt.Fprintf(server.out, "新连接来自: %s\n", conn.RemotePeer())
+					server.handleConnection(libp2pConn)
+				}
+			}()
+		},
+		DisconnectedF: func(n network.Network, conn network.Conn) {
+			router.remove(conn)
 		},
 	}
 	h.Network().Notify(notifee)
 
-	go server.printStats()
+	server.startBackground()
 
 	// 保持运行
 	select {}
 }
 
 func runServer() {
-	mode := flag.String("mode", "native", "连接模式: native 或 libp2p")
-	addr := flag.String("addr", "0.0.0.0:4363", "监听地址 (native模式)")
-	listenAddr := flag.String("listen", "/ip4/0.0.0.0/udp/4363/quic-v1", "监听地址 (libp2p模式)")
+	var serverConfig ServerConfig
+
+	flag.StringVar(&serverConfig.Mode, "mode", "native", "连接模式: native、stream、webtransport、h3、udp、masque、libp2p 或 libp2p-webrtc (native同时接受stream、webtransport和h3模式，masque运行CONNECT-UDP代理)")
+	flag.StringVar(&serverConfig.Addr, "addr", "0.0.0.0:4363", "监听地址 (native、stream、webtransport、h3、udp和masque模式)")
+	flag.StringVar(&serverConfig.UDPAddr, "udp-addr", "", "native模式下额外监听裸UDP的地址，用于对照测试，例如 0.0.0.0:4364")
+	flag.StringVar(&serverConfig.ListenAddr, "listen", "/ip4/0.0.0.0/udp/4363/quic-v1", "监听地址 (libp2p模式；libp2p-webrtc模式使用 /ip4/0.0.0.0/udp/4363/webrtc-direct)")
+	flag.StringVar(&serverConfig.Rendezvous, "rendezvous", defaultRendezvous, "libp2p模式在DHT中登记的rendezvous命名空间，为空时不登记")
+	flag.BoolVar(&serverConfig.DHT, "dht", false, "libp2p模式在没有bootstrap节点时也应答DHT查询，作为其他节点的bootstrap节点")
+	flag.BoolVar(&serverConfig.MDNS, "mdns", false, "libp2p模式通过mDNS在局域网内通告本节点，客户端使用 -discover 查找")
+	flag.BoolVar(&serverConfig.Echo, "echo", false, "将收到的数据报回显给客户端，用于往返时延测量")
+	flag.StringVar(&serverConfig.Metrics, "metrics", "", "Prometheus指标HTTP监听地址，例如 :9090 (默认不启用)")
+	flag.StringVar(&serverConfig.Output, "output", OutputText, "输出格式: text 或 json")
+	flag.StringVar(&serverConfig.OutputFile, "output-file", "", "将JSON结果和周期快照写入指定文件")
+	flag.BoolVar(&serverConfig.Verbose, "verbose", false, "逐包输出收到的数据报，高速率下会成为瓶颈")
 	flag.Parse()
 
-	var err error
-	if *mode == "libp2p" {
-		config, err := LoadOrCreateConfig()
-		if err != nil {
-			log.Fatalf("加载配置失败: %v", err)
+	reporter, err := NewReporter(serverConfig.Output, serverConfig.OutputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reporter.Close()
+
+	switch serverConfig.Mode {
+	case "libp2p", "libp2p-webrtc":
+		if serverConfig.Mode == "libp2p-webrtc" && !strings.Contains(serverConfig.ListenAddr, "/webrtc-direct") {
+			log.Fatal("libp2p-webrtc模式需要 -listen 指定webrtc-direct地址，例如 /ip4/0.0.0.0/udp/4363/webrtc-direct")
 		}
-		err = runLibP2PServer(*listenAddr, config)
-	} else {
-		err = runNativeServer(*addr)
+		if serverConfig.Mode == "libp2p-webrtc" && serverConfig.MDNS {
+			log.Fatal("-mdns 只支持libp2p模式，libp2p不在mDNS中通告webrtc-direct地址")
+		}
+		config, loadErr := LoadOrCreateConfig(reporter.Text())
+		if loadErr != nil {
+			log.Fatalf("加载配置失败: %v", loadErr)
+		}
+		err = runLibP2PServer(serverConfig, config, reporter)
+	case "udp":
+		err = runUDPServer(serverConfig, reporter)
+	case "masque":
+		err = runMasqueProxy(serverConfig, reporter.Text())
+	case "native", "stream", "webtransport", "h3":
+		err = runNativeServer(serverConfig, reporter)
+	default:
+		log.Fatalf("未知的模式: %s", serverConfig.Mode)
 	}
 
 	if err != nil {
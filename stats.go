@@ -1,18 +1,35 @@
 package main
 
 import (
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 )
 
 // ClientStats 客户端统计信息
 type ClientStats struct {
-	SentCount  int64
-	ErrorCount int64
-	StartTime  time.Time
-	mutex      sync.RWMutex
+	SentCount     int64
+	ErrorCount    int64
+	StartTime     time.Time
+	EndTime       time.Time
+	RequestedRate float64 // 请求的发送速率（包/秒）
+
+	// 回显模式下的往返时延统计
+	EchoCount      int64
+	DuplicateEchos int64
+	MalformedEchos int64 // 头部校验失败的回显
+	CorruptedEchos int64 // 校验和或负载内容不符的回显
+	TotalRTT       time.Duration
+	MinRTT         time.Duration
+	MaxRTT         time.Duration
+	RTTHistogram   LatencyHistogram
+	pending        map[uint64]time.Time
+	mergedPending  int64 // 合并进来的其他记录中未收到回显的包数
+	overhead       int   // 每个数据报的协议开销估计，取决于连接模式
+
+	mutex sync.RWMutex
 }
 
 func (s *ClientStats) IncrementSent() {
@@ -27,50 +44,305 @@ func (s *ClientStats) IncrementError() {
 	s.mutex.Unlock()
 }
 
-func (s *ClientStats) PrintFinal(packetSize int) {
+// MarkStart 记录发送开始时间和请求的发送速率
+func (s *ClientStats) MarkStart(requestedRate float64) {
+	s.mutex.Lock()
+	s.StartTime = time.Now()
+	s.RequestedRate = requestedRate
+	s.mutex.Unlock()
+}
+
+// MarkEnd 记录发送结束时间，使发送速率不受等待回显时间影响
+func (s *ClientStats) MarkEnd() {
+	s.mutex.Lock()
+	s.EndTime = time.Now()
+	s.mutex.Unlock()
+}
+
+// throughput 计算发送的有效吞吐和线路吞吐（bit/s），调用方需持有锁
+func (s *ClientStats) throughput(packetSize int, duration time.Duration) (goodput, wire float64) {
+	if duration <= 0 {
+		return 0, 0
+	}
+	payloadBytes := s.SentCount * int64(packetSize)
+	goodput = float64(payloadBytes) * 8 / duration.Seconds()
+	wire = float64(WireBytes(payloadBytes, s.SentCount, s.overhead)) * 8 / duration.Seconds()
+	return goodput, wire
+}
+
+// TrackSent 记录某个序列号的发送时间，用于匹配回显包计算RTT
+func (s *ClientStats) TrackSent(seqNum uint64, sendTime time.Time) {
+	s.mutex.Lock()
+	if s.pending == nil {
+		s.pending = make(map[uint64]time.Time)
+	}
+	s.pending[seqNum] = sendTime
+	s.mutex.Unlock()
+}
+
+// Forget 移除发送失败的序列号，避免其被计为回显丢失
+func (s *ClientStats) Forget(seqNum uint64) {
+	s.mutex.Lock()
+	delete(s.pending, seqNum)
+	s.mutex.Unlock()
+}
+
+// ProcessEcho 处理服务端回显的数据包，按序列号匹配并计算往返时延
+func (s *ClientStats) ProcessEcho(data []byte, out io.Writer) {
+	now := time.Now()
+	header, err := ParseHeader(data)
+	if err == nil {
+		err = VerifyPayload(header, data)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		// 回显经过往返两个方向，损坏可能发生在任一方向；未匹配的发送记录最终计为未收到回显
+		if errors.Is(err, ErrChecksum) || errors.Is(err, ErrPayloadMismatch) {
+			s.CorruptedEchos++
+			fmt.Fprintf(out, "损坏的回显数据报 #%d: %v\n", header.Seq, err)
+		} else {
+			s.MalformedEchos++
+			fmt.Fprintf(out, "畸形回显数据报: %v\n", err)
+		}
+		return
+	}
+	seqNum := header.Seq
+
+	sendTime, ok := s.pending[seqNum]
+	if !ok {
+		// 重复的回显或未知序列号
+		s.DuplicateEchos++
+		return
+	}
+	delete(s.pending, seqNum)
+
+	rtt := now.Sub(sendTime)
+	s.EchoCount++
+	s.TotalRTT += rtt
+	s.RTTHistogram.Record(rtt)
+
+	if s.MinRTT == 0 || rtt < s.MinRTT {
+		s.MinRTT = rtt
+	}
+	if rtt > s.MaxRTT {
+		s.MaxRTT = rtt
+	}
+}
+
+// echoLost 未收到回显的包数，调用方需持有锁
+func (s *ClientStats) echoLost() int64 {
+	return int64(len(s.pending)) + s.mergedPending
+}
+
+// MergeFrom 将另一个发送统计累加到当前记录，用于生成多个流的汇总视图
+func (s *ClientStats) MergeFrom(other *ClientStats) {
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.SentCount += other.SentCount
+	s.ErrorCount += other.ErrorCount
+	s.RequestedRate += other.RequestedRate
+	if !other.StartTime.IsZero() && (s.StartTime.IsZero() || other.StartTime.Before(s.StartTime)) {
+		s.StartTime = other.StartTime
+	}
+	if other.EndTime.After(s.EndTime) {
+		s.EndTime = other.EndTime
+	}
+
+	s.EchoCount += other.EchoCount
+	s.DuplicateEchos += other.DuplicateEchos
+	s.MalformedEchos += other.MalformedEchos
+	s.CorruptedEchos += other.CorruptedEchos
+	s.TotalRTT += other.TotalRTT
+	if other.MinRTT > 0 && (s.MinRTT == 0 || other.MinRTT < s.MinRTT) {
+		s.MinRTT = other.MinRTT
+	}
+	if other.MaxRTT > s.MaxRTT {
+		s.MaxRTT = other.MaxRTT
+	}
+	s.RTTHistogram.Merge(&other.RTTHistogram)
+	s.mergedPending += other.echoLost()
+}
+
+// PrintFinal 打印发送统计，title 用于区分客户端上行和服务端下行
+func (s *ClientStats) PrintFinal(w io.Writer, title string, packetSize int) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	duration := time.Since(s.StartTime)
+	if !s.EndTime.IsZero() {
+		duration = s.EndTime.Sub(s.StartTime)
+	}
 	actualRate := float64(s.SentCount) / duration.Seconds()
 
-	fmt.Printf("\n=== 客户端发送统计 ===\n")
-	fmt.Printf("发送包数: %d\n", s.SentCount)
-	fmt.Printf("发送错误: %d\n", s.ErrorCount)
-	fmt.Printf("实际发送速率: %.2f pps\n", actualRate)
-	fmt.Printf("总发送时间: %v\n", duration)
-	fmt.Printf("总数据量: %.2f MB\n", float64(s.SentCount*int64(packetSize))/1024/1024)
-	fmt.Printf("=====================\n")
+	fmt.Fprintf(w, "\n=== %s ===\n", title)
+	fmt.Fprintf(w, "发送包数: %d\n", s.SentCount)
+	fmt.Fprintf(w, "发送错误: %d\n", s.ErrorCount)
+	if s.RequestedRate > 0 {
+		fmt.Fprintf(w, "请求发送速率: %.2f pps\n", s.RequestedRate)
+		fmt.Fprintf(w, "实际发送速率: %.2f pps\n", actualRate)
+		fmt.Fprintf(w, "速率误差: %+.2f%%\n", (actualRate-s.RequestedRate)/s.RequestedRate*100)
+	} else {
+		fmt.Fprintf(w, "实际发送速率: %.2f pps\n", actualRate)
+	}
+	fmt.Fprintf(w, "总发送时间: %v\n", duration)
+	fmt.Fprintf(w, "总数据量: %.2f MB\n", float64(s.SentCount*int64(packetSize))/1024/1024)
+	goodput, wire := s.throughput(packetSize, duration)
+	fmt.Fprintf(w, "有效吞吐(goodput): %s\n", FormatBitrate(goodput))
+	fmt.Fprintf(w, "线路吞吐(含协议开销估计): %s\n", FormatBitrate(wire))
+
+	if echoLost := s.echoLost(); s.EchoCount > 0 || echoLost > 0 {
+		echoLossRate := float64(echoLost) / float64(s.EchoCount+echoLost) * 100
+
+		fmt.Fprintf(w, "--- 往返时延 (回显模式) ---\n")
+		fmt.Fprintf(w, "回显包数: %d\n", s.EchoCount)
+		fmt.Fprintf(w, "未收到回显: %d (%.2f%%)\n", echoLost, echoLossRate)
+		fmt.Fprintf(w, "重复/未知回显: %d\n", s.DuplicateEchos)
+		if s.MalformedEchos > 0 {
+			fmt.Fprintf(w, "畸形回显: %d\n", s.MalformedEchos)
+		}
+		if s.CorruptedEchos > 0 {
+			fmt.Fprintf(w, "损坏的回显: %d\n", s.CorruptedEchos)
+		}
+		if s.EchoCount > 0 {
+			fmt.Fprintf(w, "平均RTT: %v\n", s.TotalRTT/time.Duration(s.EchoCount))
+			fmt.Fprintf(w, "最小RTT: %v\n", s.MinRTT)
+			fmt.Fprintf(w, "最大RTT: %v\n", s.MaxRTT)
+			fmt.Fprintf(w, "RTT百分位: %s\n", formatPercentiles(&s.RTTHistogram))
+			fmt.Fprintf(w, "RTT分布:\n%s", s.RTTHistogram.Render())
+		}
+	}
+	fmt.Fprintf(w, "=====================\n")
 }
 
 // ServerStats 服务端统计信息
 type ServerStats struct {
-	ReceivedCount int64
-	LostCount     int64
-	TotalLatency  time.Duration
-	MinLatency    time.Duration
-	MaxLatency    time.Duration
-	LastSeqNum    uint64
-	mutex         sync.RWMutex
+	ReceivedCount  int64
+	ReceivedBytes  int64
+	WireBytes      int64 // 含协议开销估计的线路字节数
+	LostCount      int64
+	ExpiredCount   int64 // 移出接收窗口时仍未到达的包，不会再被恢复，只增不减
+	ReorderedCount int64
+	DuplicateCount int64
+	StaleCount     int64
+	MalformedCount int64 // 头部校验失败的数据报，不计入其他统计
+	CorruptedCount int64 // 校验和或负载内容不符的数据报，不计入其他统计
+	UntrackedCount int64 // 超出流数上限的新流数据报，不计入其他统计
+	TotalLatency   time.Duration
+	MinLatency     time.Duration
+	MaxLatency     time.Duration
+	Histogram      LatencyHistogram
+	Jitter         JitterTracker
+	FirstArrival   time.Time
+	LastArrival    time.Time
+
+	// 乱序距离（序列号差）和深度（到达次数差，RFC 4737 reordering extent）
+	TotalReorderDistance uint64
+	MaxReorderDistance   uint64
+	TotalReorderExtent   uint64
+	MaxReorderExtent     uint64
+
+	Tracker  SeqTracker
+	overhead int // 每个数据报的协议开销估计，取决于连接模式
+	mutex    sync.RWMutex
 }
 
-func (s *ServerStats) ProcessPacket(data []byte) {
-	if len(data) < 16 {
+// ProcessPacket 统计一个收到的测试数据报，丢包、乱序等事件写入 out；
+// verbose 时还逐包输出，高速率下输出本身会成为瓶颈，默认关闭
+func (s *ServerStats) ProcessPacket(data []byte, out io.Writer, verbose bool) {
+	now := time.Now()
+	header, err := CheckPacket(data)
+	if err != nil {
+		s.recordInvalid(header, len(data), err, out)
 		return
 	}
+	s.track(header, len(data), now, out, verbose)
+}
 
-	seqNum := binary.BigEndian.Uint64(data[:8])
-	timestamp := int64(binary.BigEndian.Uint64(data[8:16]))
-	sendTime := time.Unix(0, timestamp)
+// CheckPacket 校验数据报头部和负载内容，返回解析出的头部
+func CheckPacket(data []byte) (Header, error) {
+	header, err := ParseHeader(data)
+	if err == nil {
+		err = VerifyPayload(header, data)
+	}
+	return header, err
+}
 
-	now := time.Now()
+// recordInvalid 统计一个未通过 CheckPacket 的数据报。
+// 头部格式正确但内容被篡改的计为损坏，其余计为畸形；两者的序列号都不可信，不参与其他统计
+func (s *ServerStats) recordInvalid(header Header, size int, err error, out io.Writer) {
+	corrupted := errors.Is(err, ErrChecksum) || errors.Is(err, ErrPayloadMismatch)
+	s.mutex.Lock()
+	if corrupted {
+		s.CorruptedCount++
+	} else {
+		s.MalformedCount++
+	}
+	s.mutex.Unlock()
+
+	if corrupted {
+		fmt.Fprintf(out, "损坏数据报 #%d (%d 字节): %v\n", header.Seq, size, err)
+	} else {
+		fmt.Fprintf(out, "畸形数据报 (%d 字节): %v\n", size, err)
+	}
+}
+
+// track 统计一个已通过校验的数据报
+func (s *ServerStats) track(header Header, size int, now time.Time, out io.Writer, verbose bool) {
+	seqNum := header.Seq
+	sendTime := time.Unix(0, header.Timestamp)
 	latency := now.Sub(sendTime)
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	result := s.Tracker.Track(seqNum)
+	switch result.Class {
+	case PacketDuplicate:
+		s.DuplicateCount++
+		fmt.Fprintf(out, "收到重复包 #%d\n", seqNum)
+		return
+	case PacketStale:
+		s.StaleCount++
+		fmt.Fprintf(out, "收到窗口外迟到包 #%d\n", seqNum)
+		return
+	case PacketReordered:
+		// 迟到的包此前已被计为丢失，到达后恢复丢包计数
+		s.LostCount--
+		s.ReorderedCount++
+		s.TotalReorderDistance += result.Distance
+		s.TotalReorderExtent += result.Extent
+		if result.Distance > s.MaxReorderDistance {
+			s.MaxReorderDistance = result.Distance
+		}
+		if result.Extent > s.MaxReorderExtent {
+			s.MaxReorderExtent = result.Extent
+		}
+		fmt.Fprintf(out, "乱序包 #%d (距离 %d, 深度 %d)\n", seqNum, result.Distance, result.Extent)
+	case PacketInOrder:
+		s.ExpiredCount += int64(result.Expired)
+		if result.Gap > 0 {
+			s.LostCount += int64(result.Gap)
+			fmt.Fprintf(out, "检测到丢包: 序列号 %d-%d (丢失 %d 个包)\n",
+				seqNum-result.Gap, seqNum-1, result.Gap)
+		}
+	}
+
 	s.ReceivedCount++
+	s.ReceivedBytes += int64(size)
+	s.WireBytes += WireBytes(int64(size), 1, s.overhead)
+	if s.FirstArrival.IsZero() {
+		s.FirstArrival = now
+	}
+	s.LastArrival = now
 	s.TotalLatency += latency
+	s.Histogram.Record(latency)
+	s.Jitter.Update(sendTime, now)
 
 	if s.MinLatency == 0 || latency < s.MinLatency {
 		s.MinLatency = latency
@@ -79,20 +351,58 @@ func (s *ServerStats) ProcessPacket(data []byte) {
 		s.MaxLatency = latency
 	}
 
-	// 检测丢包
-	if seqNum > s.LastSeqNum+1 {
-		lost := seqNum - s.LastSeqNum - 1
-		s.LostCount += int64(lost)
-		fmt.Printf("检测到丢包: 序列号 %d-%d (丢失 %d 个包)\n",
-			s.LastSeqNum+1, seqNum-1, lost)
+	if verbose {
+		fmt.Fprintf(out, "收到包 #%d, 延迟: %v, 大小: %d 字节\n",
+			seqNum, latency, size)
+	}
+}
+
+// MergeFrom 将另一个统计记录累加到当前记录，用于生成汇总视图
+func (s *ServerStats) MergeFrom(other *ServerStats) {
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ReceivedCount += other.ReceivedCount
+	s.ReceivedBytes += other.ReceivedBytes
+	s.WireBytes += other.WireBytes
+	if !other.FirstArrival.IsZero() && (s.FirstArrival.IsZero() || other.FirstArrival.Before(s.FirstArrival)) {
+		s.FirstArrival = other.FirstArrival
+	}
+	if other.LastArrival.After(s.LastArrival) {
+		s.LastArrival = other.LastArrival
+	}
+	s.LostCount += other.LostCount
+	s.ExpiredCount += other.ExpiredCount
+	s.ReorderedCount += other.ReorderedCount
+	s.DuplicateCount += other.DuplicateCount
+	s.StaleCount += other.StaleCount
+	s.MalformedCount += other.MalformedCount
+	s.CorruptedCount += other.CorruptedCount
+	s.UntrackedCount += other.UntrackedCount
+	s.TotalLatency += other.TotalLatency
+	s.TotalReorderDistance += other.TotalReorderDistance
+	s.TotalReorderExtent += other.TotalReorderExtent
+	if other.MaxReorderDistance > s.MaxReorderDistance {
+		s.MaxReorderDistance = other.MaxReorderDistance
+	}
+	if other.MaxReorderExtent > s.MaxReorderExtent {
+		s.MaxReorderExtent = other.MaxReorderExtent
 	}
-	s.LastSeqNum = seqNum
 
-	fmt.Printf("收到包 #%d, 延迟: %v, 大小: %d 字节\n",
-		seqNum, latency, len(data))
+	if other.MinLatency > 0 && (s.MinLatency == 0 || other.MinLatency < s.MinLatency) {
+		s.MinLatency = other.MinLatency
+	}
+	if other.MaxLatency > s.MaxLatency {
+		s.MaxLatency = other.MaxLatency
+	}
+	s.Histogram.Merge(&other.Histogram)
+	s.Jitter.Merge(&other.Jitter)
 }
 
-func (s *ServerStats) Print() {
+// Print 打印统计信息，title 用于区分不同会话或汇总视图
+func (s *ServerStats) Print(w io.Writer, title string) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -100,44 +410,177 @@ func (s *ServerStats) Print() {
 		avgLatency := s.TotalLatency / time.Duration(s.ReceivedCount)
 		lossRate := float64(s.LostCount) / float64(s.ReceivedCount+s.LostCount) * 100
 
-		fmt.Printf("\n=== 统计信息 ===\n")
-		fmt.Printf("接收包数: %d\n", s.ReceivedCount)
-		fmt.Printf("丢失包数: %d\n", s.LostCount)
-		fmt.Printf("丢包率: %.2f%%\n", lossRate)
-		fmt.Printf("平均延迟: %v\n", avgLatency)
-		fmt.Printf("最小延迟: %v\n", s.MinLatency)
-		fmt.Printf("最大延迟: %v\n", s.MaxLatency)
-		fmt.Printf("================\n\n")
+		fmt.Fprintf(w, "\n=== %s ===\n", title)
+		fmt.Fprintf(w, "接收包数: %d\n", s.ReceivedCount)
+		fmt.Fprintf(w, "丢失包数: %d\n", s.LostCount)
+		fmt.Fprintf(w, "丢包率: %.2f%%\n", lossRate)
+		fmt.Fprintf(w, "乱序包数: %d\n", s.ReorderedCount)
+		if s.ReorderedCount > 0 {
+			fmt.Fprintf(w, "乱序距离: 平均 %.1f, 最大 %d\n",
+				float64(s.TotalReorderDistance)/float64(s.ReorderedCount), s.MaxReorderDistance)
+			fmt.Fprintf(w, "乱序深度: 平均 %.1f, 最大 %d\n",
+				float64(s.TotalReorderExtent)/float64(s.ReorderedCount), s.MaxReorderExtent)
+		}
+		fmt.Fprintf(w, "重复包数: %d\n", s.DuplicateCount)
+		if s.StaleCount > 0 {
+			fmt.Fprintf(w, "窗口外迟到包数: %d\n", s.StaleCount)
+		}
+		if s.MalformedCount > 0 {
+			fmt.Fprintf(w, "畸形数据报: %d\n", s.MalformedCount)
+		}
+		if s.CorruptedCount > 0 {
+			fmt.Fprintf(w, "损坏数据报: %d\n", s.CorruptedCount)
+		}
+		if s.UntrackedCount > 0 {
+			fmt.Fprintf(w, "超出流数上限未统计: %d\n", s.UntrackedCount)
+		}
+		if goodput, wire := s.throughput(); goodput > 0 {
+			fmt.Fprintf(w, "有效吞吐(goodput): %s\n", FormatBitrate(goodput))
+			fmt.Fprintf(w, "线路吞吐(含协议开销估计): %s\n", FormatBitrate(wire))
+		}
+		fmt.Fprintf(w, "平均延迟: %v\n", avgLatency)
+		fmt.Fprintf(w, "最小延迟: %v\n", s.MinLatency)
+		fmt.Fprintf(w, "最大延迟: %v\n", s.MaxLatency)
+		fmt.Fprintf(w, "延迟百分位: %s\n", formatPercentiles(&s.Histogram))
+		fmt.Fprintf(w, "抖动(RFC 3550): %s\n", s.Jitter.String())
+		fmt.Fprintf(w, "================\n\n")
 	}
 }
 
-// GeneratePayload 生成测试数据包
-func GeneratePayload(seqNum uint64, packetSize int, payloadType string) []byte {
-	payload := make([]byte, packetSize)
+// throughput 按首个和最后一个包的到达时间计算接收的有效吞吐和线路吞吐（bit/s），调用方需持有锁
+func (s *ServerStats) throughput() (goodput, wire float64) {
+	elapsed := s.LastArrival.Sub(s.FirstArrival).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	goodput = float64(s.ReceivedBytes) * 8 / elapsed
+	// 各会话的模式可能不同，线路字节数在收包时按所属模式累加
+	wire = float64(s.WireBytes) * 8 / elapsed
+	return goodput, wire
+}
 
-	// 前8字节：序列号
-	binary.BigEndian.PutUint64(payload[:8], seqNum)
+// PrintFinal 打印最终报告，在 Print 的基础上附加延迟分布直方图
+func (s *ServerStats) PrintFinal(w io.Writer, title string) {
+	s.Print(w, title)
 
-	// 接下来8字节：时间戳（纳秒）
-	timestamp := time.Now().UnixNano()
-	binary.BigEndian.PutUint64(payload[8:16], uint64(timestamp))
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	// 剩余部分：根据配置生成数据
+	if s.Histogram.Count() > 0 {
+		fmt.Fprintf(w, "延迟分布:\n%s\n", s.Histogram.Render())
+	}
+	if len(s.Jitter.Series()) > 0 {
+		fmt.Fprintf(w, "抖动时间序列 (每%v, 最近%d个): %s\n\n",
+			jitterSampleInterval, jitterSeriesPrintLimit, s.Jitter.RenderSeries(jitterSeriesPrintLimit))
+	}
+}
+
+// jitterSeriesPrintLimit 最终报告中打印的抖动采样点数
+const jitterSeriesPrintLimit = 60
+
+// formatPercentiles 格式化常用的延迟百分位
+func formatPercentiles(h *LatencyHistogram) string {
+	return fmt.Sprintf("p50=%v p90=%v p99=%v p99.9=%v",
+		h.Percentile(50), h.Percentile(90), h.Percentile(99), h.Percentile(99.9))
+}
+
+// 头部中的负载类型编码
+const (
+	payloadUnverified byte = iota // 接收方不校验负载
+	payloadRandom
+	payloadSequential
+	payloadConstant
+)
+
+// payloadTypeCode 将 -payload 参数映射为头部中的负载类型，未知类型按固定值填充
+func payloadTypeCode(payloadType string) byte {
 	switch payloadType {
 	case "random":
-		// 使用简单的伪随机填充
-		for i := 16; i < len(payload); i++ {
-			payload[i] = byte((seqNum*uint64(i) + uint64(i)) % 256)
-		}
+		return payloadRandom
 	case "sequential":
-		for i := 16; i < len(payload); i++ {
-			payload[i] = byte(i % 256)
-		}
+		return payloadSequential
 	default:
-		for i := 16; i < len(payload); i++ {
-			payload[i] = byte(seqNum % 256)
-		}
+		return payloadConstant
 	}
+}
 
+// payloadByte 返回负载第 i 个字节（从数据报开头计）的预期值，负载只依赖序列号和位置
+func payloadByte(code byte, seqNum uint64, i int) byte {
+	switch code {
+	case payloadRandom:
+		// 简单的伪随机填充
+		return byte((seqNum*uint64(i) + uint64(i)) % 256)
+	case payloadSequential:
+		return byte(i % 256)
+	default:
+		return byte(seqNum % 256)
+	}
+}
+
+// GeneratePayload 生成测试数据包
+func GeneratePayload(header Header, packetSize int, payloadType string) []byte {
+	if packetSize < HeaderLen {
+		packetSize = HeaderLen
+	}
+	payload := make([]byte, packetSize)
+
+	// 头部：时间戳（纳秒）在生成时填入
+	header.Timestamp = time.Now().UnixNano()
+	header.PayloadLen = uint16(packetSize - HeaderLen)
+	header.PayloadType = payloadTypeCode(payloadType)
+	header.Encode(payload)
+
+	// 剩余部分：根据负载类型生成数据
+	for i := HeaderLen; i < len(payload); i++ {
+		payload[i] = payloadByte(header.PayloadType, header.Seq, i)
+	}
+
+	SealDatagram(payload)
 	return payload
 }
+
+// VerifyPayload 按头部中的序列号和负载类型重新生成负载并逐字节比对，
+// 返回第一个不符的位置；负载类型为0或未知时不校验
+func VerifyPayload(header Header, data []byte) error {
+	if header.PayloadType == payloadUnverified || header.PayloadType > payloadConstant {
+		return nil
+	}
+	for i := HeaderLen; i < len(data); i++ {
+		if data[i] != payloadByte(header.PayloadType, header.Seq, i) {
+			return fmt.Errorf("%w: 偏移 %d", ErrPayloadMismatch, i)
+		}
+	}
+	return nil
+}
+
+// PrintEndToEnd 合并客户端发送统计和服务端最终接收统计，打印端到端报告
+func PrintEndToEnd(w io.Writer, client ClientSnapshot, server ServerSnapshot) {
+	missing := client.Sent - server.Received
+	if missing < 0 {
+		missing = 0
+	}
+
+	fmt.Fprintf(w, "\n=== 端到端测试报告 ===\n")
+	fmt.Fprintf(w, "客户端发送: %d, 服务端接收: %d\n", client.Sent, server.Received)
+	if client.Sent > 0 {
+		fmt.Fprintf(w, "端到端丢包: %d (%.2f%%)\n", missing, float64(missing)/float64(client.Sent)*100)
+	}
+	fmt.Fprintf(w, "乱序包数: %d, 重复包数: %d\n", server.Reordered, server.Duplicate)
+	if server.Malformed > 0 || server.Corrupted > 0 {
+		fmt.Fprintf(w, "畸形数据报: %d, 损坏数据报: %d\n", server.Malformed, server.Corrupted)
+	}
+	fmt.Fprintf(w, "发送速率: %.2f pps, 发送有效吞吐: %s\n", client.Rate, FormatBitrate(client.GoodputBps))
+	fmt.Fprintf(w, "接收有效吞吐: %s, 接收线路吞吐: %s\n", FormatBitrate(server.GoodputBps), FormatBitrate(server.WireBps))
+	if server.Latency.Count > 0 {
+		fmt.Fprintf(w, "单向延迟: 最小 %v, 平均 %v, 最大 %v\n",
+			time.Duration(server.Latency.MinNs), time.Duration(server.Latency.AvgNs), time.Duration(server.Latency.MaxNs))
+		fmt.Fprintf(w, "单向延迟百分位: p50=%v p90=%v p99=%v p99.9=%v\n",
+			time.Duration(server.Latency.P50Ns), time.Duration(server.Latency.P90Ns),
+			time.Duration(server.Latency.P99Ns), time.Duration(server.Latency.P999Ns))
+	}
+	fmt.Fprintf(w, "抖动: 平均 %v, 最大 %v\n", time.Duration(server.Jitter.MeanNs), time.Duration(server.Jitter.MaxNs))
+	if client.RTT != nil {
+		fmt.Fprintf(w, "往返时延: p50=%v p99=%v\n", time.Duration(client.RTT.P50Ns), time.Duration(client.RTT.P99Ns))
+	}
+	fmt.Fprintf(w, "=====================\n")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// testPacket 生成一个通过校验的测试数据报
+func testPacket(flow uint32, seq uint64) []byte {
+	return GeneratePayload(Header{FlowID: flow, Seq: seq}, 64, "random")
+}
+
+func TestClientStatsProcessEcho(t *testing.T) {
+	var stats ClientStats
+	now := time.Now()
+	stats.TrackSent(1, now.Add(-20*time.Millisecond))
+	stats.TrackSent(2, now.Add(-10*time.Millisecond))
+	stats.TrackSent(3, now)
+
+	stats.ProcessEcho(testPacket(0, 1), io.Discard)
+	stats.ProcessEcho(testPacket(0, 2), io.Discard)
+	stats.ProcessEcho(testPacket(0, 1), io.Discard)  // 重复的回显
+	stats.ProcessEcho(testPacket(0, 99), io.Discard) // 未发送过的序列号
+
+	if stats.EchoCount != 2 || stats.DuplicateEchos != 2 {
+		t.Errorf("回显 %d, 重复 %d, want 2, 2", stats.EchoCount, stats.DuplicateEchos)
+	}
+	if stats.MinRTT < 10*time.Millisecond || stats.MaxRTT < 20*time.Millisecond || stats.MinRTT > stats.MaxRTT {
+		t.Errorf("RTT 最小 %v, 最大 %v, want 至少 10ms 和 20ms", stats.MinRTT, stats.MaxRTT)
+	}
+	if got := stats.RTTHistogram.Count(); got != 2 {
+		t.Errorf("RTT直方图记录 %d 个样本, want 2", got)
+	}
+	if got := stats.echoLost(); got != 1 {
+		t.Errorf("未收到回显 %d, want 1", got)
+	}
+}
+
+func TestServerStatsMergeFrom(t *testing.T) {
+	var a, b ServerStats
+	a.ProcessPacket(testPacket(0, 1), io.Discard, false)
+	a.ProcessPacket(testPacket(0, 3), io.Discard, false)
+	b.ProcessPacket(testPacket(0, 1), io.Discard, false)
+	b.ProcessPacket(testPacket(0, 1), io.Discard, false)
+
+	var total ServerStats
+	total.MergeFrom(&a)
+	total.MergeFrom(&b)
+
+	if total.ReceivedCount != 3 || total.LostCount != 1 || total.DuplicateCount != 1 {
+		t.Errorf("接收 %d, 丢失 %d, 重复 %d, want 3, 1, 1", total.ReceivedCount, total.LostCount, total.DuplicateCount)
+	}
+	if total.MinLatency != min(a.MinLatency, b.MinLatency) || total.MaxLatency != max(a.MaxLatency, b.MaxLatency) {
+		t.Errorf("汇总延迟 %v..%v 不是各连接的最小和最大值", total.MinLatency, total.MaxLatency)
+	}
+	if got := total.Histogram.Count(); got != 3 {
+		t.Errorf("延迟直方图记录 %d 个样本, want 3", got)
+	}
+}
+
+func TestVerifyPayload(t *testing.T) {
+	for _, payloadType := range []string{"random", "sequential", "constant"} {
+		t.Run(payloadType, func(t *testing.T) {
+			data := GeneratePayload(Header{Seq: 77}, 128, payloadType)
+			header, err := ParseHeader(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyPayload(header, data); err != nil {
+				t.Fatalf("未修改的负载校验失败: %v", err)
+			}
+			data[HeaderLen+5] ^= 0x01
+			if err := VerifyPayload(header, data); !errors.Is(err, ErrPayloadMismatch) {
+				t.Errorf("修改负载后 err = %v, want %v", err, ErrPayloadMismatch)
+			}
+		})
+	}
+
+	t.Run("不校验的负载类型", func(t *testing.T) {
+		data := GeneratePayload(Header{Seq: 77}, 128, "random")
+		data[26] = payloadUnverified
+		data[HeaderLen] ^= 0xff
+		header, err := ParseHeader(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyPayload(header, data); err != nil {
+			t.Errorf("负载类型为0时不应校验: %v", err)
+		}
+	})
+}
+
+func TestProcessPacketCorruption(t *testing.T) {
+	tests := []struct {
+		name          string
+		flags         byte
+		payloadType   string
+		offset        int // 被翻转的字节
+		wantMalformed int64
+		wantCorrupted int64
+		wantReceived  int64
+	}{
+		{"未修改", 0, "random", -1, 0, 0, 1},
+		{"负载字节被修改", 0, "random", HeaderLen + 3, 0, 1, 0},
+		{"带校验和时负载字节被修改", FlagChecksum, "random", HeaderLen + 3, 0, 1, 0},
+		{"序列号被修改，负载与之不符", 0, "random", 15, 0, 1, 0},
+		{"带校验和时序列号被修改", FlagChecksum, "sequential", 15, 0, 1, 0},
+		{"魔数被修改", 0, "random", 0, 1, 0, 0},
+		{"版本被修改", FlagChecksum, "random", 2, 1, 0, 0},
+		{"负载长度被修改", FlagChecksum, "random", 25, 1, 0, 0},
+		// sequential 负载与序列号无关，没有校验和时无法发现序列号被修改
+		{"无校验和时序列号被修改", 0, "sequential", 15, 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := GeneratePayload(Header{Flags: tt.flags, Seq: 5}, 96, tt.payloadType)
+			if tt.offset >= 0 {
+				data[tt.offset] ^= 0x04
+			}
+
+			var stats ServerStats
+			stats.ProcessPacket(data, io.Discard, false)
+			if stats.MalformedCount != tt.wantMalformed || stats.CorruptedCount != tt.wantCorrupted ||
+				stats.ReceivedCount != tt.wantReceived {
+				t.Errorf("畸形 %d, 损坏 %d, 接收 %d, want %d, %d, %d",
+					stats.MalformedCount, stats.CorruptedCount, stats.ReceivedCount,
+					tt.wantMalformed, tt.wantCorrupted, tt.wantReceived)
+			}
+		})
+	}
+}
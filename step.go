@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// MeasurementStep 在同一连接上以固定速率和包大小发送一段时间的测量结果，
+// 用于饱和测试和尺寸/速率矩阵测试
+type MeasurementStep struct {
+	Size            int     `json:"size"`
+	Rate            int     `json:"rate_pps"`
+	AchievedRate    float64 `json:"achieved_rate_pps"`
+	Sent            int64   `json:"sent"`
+	Received        int64   `json:"received"`
+	LossRate        float64 `json:"loss_rate"`
+	P50Ns           int64   `json:"p50_ns"`
+	P99Ns           int64   `json:"p99_ns"`
+	JitterNs        int64   `json:"jitter_ns,omitempty"` // 平均到达间隔抖动
+	LatencyGrowthNs int64   `json:"latency_growth_ns,omitempty"`
+	GoodputBps      float64 `json:"goodput_bps"`
+	WireBps         float64 `json:"wire_bps"`
+	OK              bool    `json:"ok,omitempty"`
+}
+
+// runMeasurementStep 重置服务端统计，以指定速率和包大小发送 -step-duration，
+// 等待 -settle 后从服务端取回该步的接收统计
+func (c *Client) runMeasurementStep(rate, size int) (MeasurementStep, error) {
+	step, _, err := c.measureStep(rate, size, c.config.StepDuration, nil)
+	return step, err
+}
+
+// measureStep 执行一步测量。background 不为nil时在发送期间于另一协程运行，
+// 发送结束后取消其ctx并等待返回，再等待在途数据报。同时返回服务端的完整统计报告。
+func (c *Client) measureStep(rate, size int, duration time.Duration, background func(ctx context.Context)) (MeasurementStep, StatsReport, error) {
+	if err := c.resetServerStats(); err != nil {
+		return MeasurementStep{}, StatsReport{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	if background != nil {
+		go func() {
+			background(ctx)
+			close(done)
+		}()
+	} else {
+		close(done)
+	}
+
+	stats := ClientStats{overhead: wireOverhead(c.config.Mode)}
+	runSender(context.Background(), c.conn, SendSpec{
+		Rate:        rate,
+		Size:        size,
+		Duration:    duration,
+		PayloadType: c.config.PayloadType,
+		Flags:       c.headerFlags(),
+		Out:         c.out,
+	}, &stats)
+	cancel()
+	<-done
+	// 等待在途数据报到达服务端
+	time.Sleep(c.config.Settle)
+
+	report, err := c.fetchServerReport()
+	if err != nil {
+		return MeasurementStep{}, StatsReport{}, err
+	}
+	server := report.Stats
+
+	sent := stats.Snapshot(size)
+	step := MeasurementStep{
+		Size:         size,
+		Rate:         rate,
+		AchievedRate: sent.Rate,
+		Sent:         sent.Sent,
+		Received:     server.Received,
+		P50Ns:        server.Latency.P50Ns,
+		P99Ns:        server.Latency.P99Ns,
+		JitterNs:     server.Jitter.MeanNs,
+		GoodputBps:   server.GoodputBps,
+		WireBps:      server.WireBps,
+	}
+	// 以发送数计算丢包，步末尾丢失的包无法通过序列号缺口发现
+	if sent.Sent > 0 && server.Received < sent.Sent {
+		step.LossRate = 1 - float64(server.Received)/float64(sent.Sent)
+	}
+	return step, report, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// streamModeALPN stream模式使用的ALPN，服务端据此把连接包装为 StreamConnection
+	streamModeALPN = "quic-datagram-test-stream"
+	// messageStreamPreface stream模式消息流开头的前缀，客户端建立连接后立即写入，
+	// 使消息流先于控制流到达服务端
+	messageStreamPreface = "QDMSG1\n"
+	// streamMessageMax 长度前缀为2字节，单条消息的最大长度
+	streamMessageMax = 0xFFFF
+)
+
+// StreamConnection 在单条QUIC流上以2字节长度前缀逐条传输消息，代替DATAGRAM帧，
+// 用于比较可靠有序传输下的队头阻塞。控制流和批量数据流仍使用连接上的其他流。
+type StreamConnection struct {
+	conn       *quic.Conn
+	stream     *quic.Stream
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+}
+
+// dialStreamConnection 以stream模式的ALPN连接服务端并打开消息流
+func dialStreamConnection(ctx context.Context, addr string) (*StreamConnection, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{streamModeALPN},
+	}
+	conn, err := quic.DialAddr(ctx, addr, tlsConfig, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, fmt.Errorf("打开消息流失败: %w", err)
+	}
+	if _, err := stream.Write([]byte(messageStreamPreface)); err != nil {
+		conn.CloseWithError(0, "")
+		return nil, fmt.Errorf("写入消息流失败: %w", err)
+	}
+	return &StreamConnection{conn: conn, stream: stream, reader: bufio.NewReader(stream)}, nil
+}
+
+// acceptStreamConnection 在服务端接受客户端打开的消息流并校验前缀
+func acceptStreamConnection(ctx context.Context, conn *quic.Conn) (*StreamConnection, error) {
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("等待消息流失败: %w", err)
+	}
+
+	reader := bufio.NewReader(stream)
+	prefix := make([]byte, len(messageStreamPreface))
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return nil, fmt.Errorf("读取消息流前缀失败: %w", err)
+	}
+	if string(prefix) != messageStreamPreface {
+		return nil, fmt.Errorf("消息流前缀不正确")
+	}
+	return &StreamConnection{conn: conn, stream: stream, reader: reader}, nil
+}
+
+func (c *StreamConnection) SendDatagram(data []byte) error {
+	// 与QUIC数据报一致地返回 DatagramTooLargeError，使尺寸探测对各模式通用
+	if len(data) > streamMessageMax {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: streamMessageMax}
+	}
+
+	msg := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(msg, uint16(len(data)))
+	copy(msg[2:], data)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.stream.Write(msg)
+	return err
+}
+
+// ReceiveDatagram 读取下一条消息，同一连接只应有一个协程调用
+func (c *StreamConnection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	defer interruptRead(ctx, c.stream.SetReadDeadline)()
+
+	var prefix [2]byte
+	if _, err := io.ReadFull(c.reader, prefix[:]); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *StreamConnection) OpenStream(ctx context.Context) (Stream, error) {
+	stream, err := c.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *StreamConnection) AcceptStream(ctx context.Context) (Stream, error) {
+	stream, err := c.conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *StreamConnection) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+func (c *StreamConnection) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseIntList 解析逗号分隔的整数列表，每一项可以是单个值或 "起始-结束:步长" 形式的范围，
+// 例如 "64,256,1024" 或 "200-1200:200,1400"。范围省略步长时只取两端。
+func ParseIntList(s string) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		rangePart, stepPart, hasStep := strings.Cut(item, ":")
+		startPart, endPart, isRange := strings.Cut(rangePart, "-")
+		if !isRange {
+			if hasStep {
+				return nil, fmt.Errorf("无效的列表项 %q: 步长只能用于范围", item)
+			}
+			v, err := strconv.Atoi(item)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("无效的列表项 %q", item)
+			}
+			values = append(values, v)
+			continue
+		}
+
+		start, err1 := strconv.Atoi(strings.TrimSpace(startPart))
+		end, err2 := strconv.Atoi(strings.TrimSpace(endPart))
+		if err1 != nil || err2 != nil || start <= 0 || end < start {
+			return nil, fmt.Errorf("无效的范围 %q (示例: 200-1200:200)", item)
+		}
+		step := end - start
+		if hasStep {
+			step, err1 = strconv.Atoi(strings.TrimSpace(stepPart))
+			if err1 != nil || step <= 0 {
+				return nil, fmt.Errorf("无效的范围步长 %q", item)
+			}
+		}
+		if step == 0 {
+			step = 1
+		}
+		for v := start; v <= end; v += step {
+			values = append(values, v)
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("列表 %q 为空", s)
+	}
+	return values, nil
+}
+
+// sweepEnabled 是否运行尺寸/速率矩阵测试
+func (c *Client) sweepEnabled() bool {
+	return c.config.Sizes != "" || c.config.Rates != ""
+}
+
+// sweepSizes 返回矩阵测试的包大小列表，超出探测上限的按 -clamp-size 缩小或报错
+func (c *Client) sweepSizes() ([]int, error) {
+	if c.config.Sizes == "" {
+		return []int{c.config.PacketSize}, nil
+	}
+
+	sizes, err := ParseIntList(c.config.Sizes)
+	if err != nil {
+		return nil, fmt.Errorf("-sizes: %w", err)
+	}
+
+	var result []int
+	seen := make(map[int]bool)
+	for _, size := range sizes {
+		if size < HeaderLen {
+			return nil, fmt.Errorf("-sizes: 包大小 %d 小于数据报头部长度 %d 字节", size, HeaderLen)
+		}
+		if size > MaxPacketSize {
+			return nil, fmt.Errorf("-sizes: 包大小 %d 超过测试数据报的最大长度 %d 字节", size, MaxPacketSize)
+		}
+		if c.sizeProbe != nil && size > c.sizeProbe.MaxSize {
+			if !c.config.ClampSize {
+				return nil, fmt.Errorf("-sizes: 包大小 %d 超出可用的最大数据报负载 %d 字节", size, c.sizeProbe.MaxSize)
+			}
+			fmt.Fprintf(c.out, "包大小 %d 超出可用的最大数据报负载，已缩小为 %d 字节\n", size, c.sizeProbe.MaxSize)
+			size = c.sizeProbe.MaxSize
+		}
+		if !seen[size] {
+			seen[size] = true
+			result = append(result, size)
+		}
+	}
+	return result, nil
+}
+
+// sweepRates 返回某个包大小对应的速率列表。
+// 未指定 -rates 时使用 -rate；同时指定了 -bitrate 则按包大小换算，使各档线路比特率相同。
+func (c *Client) sweepRates(size int, bitrate float64) ([]int, error) {
+	if c.config.Rates != "" {
+		rates, err := ParseIntList(c.config.Rates)
+		if err != nil {
+			return nil, fmt.Errorf("-rates: %w", err)
+		}
+		return rates, nil
+	}
+	if bitrate > 0 {
+		return []int{RateForBitrate(bitrate, size, wireOverhead(c.config.Mode))}, nil
+	}
+	return []int{c.config.SendRate}, nil
+}
+
+// runSweep 在同一连接上依次运行每个包大小和速率的组合
+func (c *Client) runSweep(bitrate float64) ([]MeasurementStep, error) {
+	sizes, err := c.sweepSizes()
+	if err != nil {
+		return nil, err
+	}
+	// 先解析全部速率，避免跑完部分组合后才发现参数错误
+	rates := make(map[int][]int, len(sizes))
+	total := 0
+	for _, size := range sizes {
+		if rates[size], err = c.sweepRates(size, bitrate); err != nil {
+			return nil, err
+		}
+		total += len(rates[size])
+	}
+
+	fmt.Fprintf(c.out, "矩阵测试: %d 个组合，每步 %v，预计耗时 %v\n",
+		total, c.config.StepDuration, time.Duration(total)*(c.config.StepDuration+c.config.Settle))
+
+	var steps []MeasurementStep
+	for _, size := range sizes {
+		for _, rate := range rates[size] {
+			step, err := c.runMeasurementStep(rate, size)
+			if err != nil {
+				return steps, err
+			}
+			steps = append(steps, step)
+			fmt.Fprintf(c.out, "[%d/%d] %d 字节 @ %d pps: 实际 %.0f pps, 丢包率 %.2f%%, p50 %v, 有效吞吐 %s\n",
+				len(steps), total, size, rate, step.AchievedRate, step.LossRate*100,
+				time.Duration(step.P50Ns), FormatBitrate(step.GoodputBps))
+		}
+	}
+	return steps, nil
+}
+
+// payloadEfficiency 每包开销为 overhead 字节时负载字节占线路字节的比例
+func payloadEfficiency(size, overhead int) float64 {
+	return float64(size) / float64(size+overhead)
+}
+
+// PrintSweep 打印矩阵测试的对比表，overhead 为当前模式的每包协议开销
+func PrintSweep(w io.Writer, steps []MeasurementStep, overhead int) {
+	fmt.Fprintf(w, "\n=== 尺寸/速率矩阵测试结果 ===\n")
+	fmt.Fprintf(w, "%8s %10s %12s %10s %12s %12s %14s %14s %8s\n",
+		"大小", "速率(pps)", "实际(pps)", "丢包率", "p50", "p99", "有效吞吐", "线路吞吐", "负载效率")
+	for _, step := range steps {
+		fmt.Fprintf(w, "%8d %10d %12.0f %9.2f%% %12v %12v %14s %14s %7.1f%%\n",
+			step.Size, step.Rate, step.AchievedRate, step.LossRate*100,
+			time.Duration(step.P50Ns), time.Duration(step.P99Ns),
+			FormatBitrate(step.GoodputBps), FormatBitrate(step.WireBps),
+			payloadEfficiency(step.Size, overhead)*100)
+	}
+	fmt.Fprintf(w, "负载效率 = 包大小 / (包大小 + 每包约 %d 字节的协议开销)\n", overhead)
+	fmt.Fprintf(w, "==============================\n")
+}
+
+// WriteSweepCSV 将矩阵测试结果写入CSV文件
+func WriteSweepCSV(path string, steps []MeasurementStep, overhead int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建CSV文件失败: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{
+		"size", "rate_pps", "achieved_rate_pps", "sent", "received", "loss_rate",
+		"p50_ns", "p99_ns", "goodput_bps", "wire_bps", "payload_efficiency",
+	})
+	for _, step := range steps {
+		w.Write([]string{
+			strconv.Itoa(step.Size),
+			strconv.Itoa(step.Rate),
+			strconv.FormatFloat(step.AchievedRate, 'f', 1, 64),
+			strconv.FormatInt(step.Sent, 10),
+			strconv.FormatInt(step.Received, 10),
+			strconv.FormatFloat(step.LossRate, 'f', 6, 64),
+			strconv.FormatInt(step.P50Ns, 10),
+			strconv.FormatInt(step.P99Ns, 10),
+			strconv.FormatFloat(step.GoodputBps, 'f', 0, 64),
+			strconv.FormatFloat(step.WireBps, 'f', 0, 64),
+			strconv.FormatFloat(payloadEfficiency(step.Size, overhead), 'f', 4, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件失败: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseIntList(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{"单个值", "1024", []int{1024}, false},
+		{"逗号分隔", "64,256,1024", []int{64, 256, 1024}, false},
+		{"空白和空项", " 64 , ,256 ", []int{64, 256}, false},
+		{"带步长的范围", "200-1200:200", []int{200, 400, 600, 800, 1000, 1200}, false},
+		{"步长不整除时不超过终点", "100-350:100", []int{100, 200, 300}, false},
+		{"省略步长只取两端", "200-1200", []int{200, 1200}, false},
+		{"起止相同", "500-500", []int{500}, false},
+		{"范围和单值混合", "200-600:200,1400", []int{200, 400, 600, 1400}, false},
+		{"空字符串", "", nil, true},
+		{"只有逗号", ",,", nil, true},
+		{"零", "0", nil, true},
+		{"负数", "-5", nil, true},
+		{"非数字", "abc", nil, true},
+		{"单值带步长", "100:10", nil, true},
+		{"终点小于起点", "1200-200", nil, true},
+		{"步长为零", "100-200:0", nil, true},
+		{"步长非数字", "100-200:x", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIntList(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIntList(%q) err = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseIntList(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// udpMaxPayload IPv4下单个UDP数据报的最大负载
+	udpMaxPayload = 65507
+	// udpIdleTimeout 服务端在该时间内未收到某个地址的数据报时结束其会话，UDP没有关闭连接的信号
+	udpIdleTimeout = 30 * time.Second
+	// udpQueueLen 服务端每个会话的接收队列长度，队列满时丢弃，与内核接收缓冲区溢出的表现相同
+	udpQueueLen = 1024
+)
+
+var (
+	errUDPIdle   = errors.New("UDP会话空闲超时")
+	errUDPClosed = errors.New("UDP连接已关闭")
+)
+
+// UDPConnection 直接在UDP套接字上收发数据报，作为QUIC数据报的对照基线。
+// 客户端使用已connect的套接字；服务端的每个远端地址对应一个 UDPConnection，
+// 共用监听套接字，由 serveUDP 按来源地址分发收到的数据报。
+type UDPConnection struct {
+	socket *net.UDPConn
+	remote *net.UDPAddr // 服务端使用，客户端为nil
+	buf    []byte       // 客户端的接收缓冲区，每次读取复用，只拷贝出实际长度
+
+	incoming  chan []byte // 服务端使用，由 serveUDP 写入
+	closed    chan struct{}
+	closeOnce sync.Once
+	onClose   func()
+}
+
+// dialUDP 创建连接到服务端地址的UDP套接字
+func dialUDP(addr string) (*UDPConnection, error) {
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	socket, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPConnection{socket: socket, buf: make([]byte, udpMaxPayload), closed: make(chan struct{})}, nil
+}
+
+func (c *UDPConnection) SendDatagram(data []byte) error {
+	// 与QUIC一致地返回 DatagramTooLargeError，使尺寸探测对各模式通用
+	if len(data) > udpMaxPayload {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: udpMaxPayload}
+	}
+	var err error
+	if c.remote == nil {
+		_, err = c.socket.Write(data)
+	} else {
+		_, err = c.socket.WriteToUDP(data, c.remote)
+	}
+	return err
+}
+
+func (c *UDPConnection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	if c.incoming != nil {
+		return c.receiveQueued(ctx)
+	}
+
+	defer interruptRead(ctx, c.socket.SetReadDeadline)()
+
+	n, err := c.socket.Read(c.buf)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return append([]byte(nil), c.buf[:n]...), nil
+}
+
+// receiveQueued 从分发队列读取服务端收到的数据报，空闲超时后关闭连接
+func (c *UDPConnection) receiveQueued(ctx context.Context) ([]byte, error) {
+	idle := time.NewTimer(udpIdleTimeout)
+	defer idle.Stop()
+
+	select {
+	case data := <-c.incoming:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, errUDPClosed
+	case <-idle.C:
+		c.Close()
+		return nil, errUDPIdle
+	}
+}
+
+func (c *UDPConnection) OpenStream(ctx context.Context) (Stream, error) {
+	return nil, errStreamsUnsupported
+}
+
+func (c *UDPConnection) AcceptStream(ctx context.Context) (Stream, error) {
+	return nil, errStreamsUnsupported
+}
+
+// Close 客户端关闭套接字；服务端只结束该会话，监听套接字继续使用
+func (c *UDPConnection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	if c.remote == nil {
+		return c.socket.Close()
+	}
+	return nil
+}
+
+func (c *UDPConnection) RemoteAddr() string {
+	if c.remote == nil {
+		return c.socket.RemoteAddr().String()
+	}
+	return c.remote.String()
+}
+
+// serveUDP 在监听套接字上接收数据报，按来源地址分发给各自的会话，
+// 新地址的第一个数据报创建新会话
+func (s *Server) serveUDP(socket *net.UDPConn) error {
+	var mutex sync.Mutex
+	conns := make(map[string]*UDPConnection)
+
+	buf := make([]byte, udpMaxPayload)
+	for {
+		n, remote, err := socket.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		data := append([]byte(nil), buf[:n]...)
+
+		key := remote.String()
+		mutex.Lock()
+		conn := conns[key]
+		if conn == nil {
+			conn = &UDPConnection{
+				socket:   socket,
+				remote:   remote,
+				incoming: make(chan []byte, udpQueueLen),
+				closed:   make(chan struct{}),
+			}
+			conn.onClose = func() {
+				mutex.Lock()
+				delete(conns, key)
+				mutex.Unlock()
+			}
+			conns[key] = conn
+			go s.handleConnection(conn)
+		}
+		mutex.Unlock()
+
+		select {
+		case conn.incoming <- data:
+		default:
+		}
+	}
+}
+
+// listenUDP 在指定地址上监听裸UDP
+func listenUDP(addr string) (*net.UDPConn, error) {
+	local, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	socket, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, fmt.Errorf("监听UDP失败: %w", err)
+	}
+	return socket, nil
+}
+
+func runUDPServer(config ServerConfig, reporter *Reporter) error {
+	socket, err := listenUDP(config.Addr)
+	if err != nil {
+		return err
+	}
+	defer socket.Close()
+
+	server := NewServer(config, reporter)
+	fmt.Fprintf(server.out, "裸UDP服务器启动，监听地址: %s\n", config.Addr)
+
+	server.startBackground()
+	return server.serveUDP(socket)
+}
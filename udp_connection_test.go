@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestUDPConnectionReceiveAfterCancel 取消的读取设置过读超时，之后的读取不应受影响，
+// 且复用的接收缓冲区不能改写已返回的数据
+func TestUDPConnectionReceiveAfterCancel(t *testing.T) {
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	conn, err := dialUDP(peer.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := conn.ReceiveDatagram(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("取消后 ReceiveDatagram err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	local := conn.socket.LocalAddr().(*net.UDPAddr)
+	for _, msg := range []string{"first", "second"} {
+		if _, err := peer.WriteToUDP([]byte(msg), local); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	first, err := conn.ReceiveDatagram(ctx)
+	if err != nil {
+		t.Fatalf("取消后再次读取失败: %v", err)
+	}
+	second, err := conn.ReceiveDatagram(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != "first" || string(second) != "second" {
+		t.Errorf("收到 %q, %q, want \"first\", \"second\"", first, second)
+	}
+}
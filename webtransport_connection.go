@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+const (
+	// webTransportPath WebTransport会话的请求路径
+	webTransportPath = "/quic-datagram-test"
+	// webTransportDatagramPrefix 每个HTTP/3数据报前的会话ID（quarter stream ID）变长整数的长度，
+	// 每个连接只有一个会话，会话ID很小，前缀为1字节
+	webTransportDatagramPrefix = 1
+)
+
+// WebTransportConnection 包装WebTransport会话，数据报通过会话的HTTP/3数据报收发，
+// 每个数据报比原生QUIC多携带会话ID前缀
+type WebTransportConnection struct {
+	session *webtransport.Session
+	conn    *quic.Conn // 客户端使用的底层连接
+	dialer  *webtransport.Dialer
+}
+
+// dialWebTransport 建立QUIC连接并发起WebTransport会话
+func dialWebTransport(ctx context.Context, addr string) (*WebTransportConnection, error) {
+	c := &WebTransportConnection{}
+	c.dialer = &webtransport.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		QUICConfig:      &quic.Config{EnableDatagrams: true},
+		DialAddr: func(ctx context.Context, addr string, tlsConfig *tls.Config, config *quic.Config) (*quic.Conn, error) {
+			conn, err := quic.DialAddrEarly(ctx, addr, tlsConfig, config)
+			c.conn = conn
+			return conn, err
+		},
+	}
+
+	resp, session, err := c.dialer.Dial(ctx, "https://"+addr+webTransportPath, nil)
+	if err != nil {
+		if c.conn != nil {
+			c.conn.CloseWithError(0, "")
+		}
+		c.dialer.Close()
+		if resp != nil {
+			return nil, fmt.Errorf("建立WebTransport会话失败 (HTTP %d): %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("建立WebTransport会话失败: %w", err)
+	}
+	c.session = session
+	return c, nil
+}
+
+// newWebTransportServer 创建在 webTransportPath 上接受WebTransport会话的服务端，
+// 每个会话交给 server.handleConnection 处理，与原生QUIC连接共用统计。
+// mux 中已注册的其他路径（HTTP数据报）由同一个HTTP/3服务端处理。
+func newWebTransportServer(server *Server, mux *http.ServeMux) *webtransport.Server {
+	wt := &webtransport.Server{
+		H3: http3.Server{Handler: mux},
+		// 浏览器客户端通常来自其他源，不检查Origin
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	mux.HandleFunc(webTransportPath, func(w http.ResponseWriter, r *http.Request) {
+		session, err := wt.Upgrade(w, r)
+		if err != nil {
+			fmt.Fprintf(server.out, "WebTransport升级失败: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		server.handleConnection(&WebTransportConnection{session: session})
+	})
+	return wt
+}
+
+func (c *WebTransportConnection) SendDatagram(data []byte) error {
+	err := c.session.SendDatagram(data)
+	// quic-go报告的上限包含会话ID前缀，换算为可用的负载长度，使尺寸探测得到正确的上限
+	var tooLarge *quic.DatagramTooLargeError
+	if errors.As(err, &tooLarge) {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: tooLarge.MaxDatagramPayloadSize - webTransportDatagramPrefix}
+	}
+	return err
+}
+
+func (c *WebTransportConnection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	return c.session.ReceiveDatagram(ctx)
+}
+
+func (c *WebTransportConnection) OpenStream(ctx context.Context) (Stream, error) {
+	stream, err := c.session.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *WebTransportConnection) AcceptStream(ctx context.Context) (Stream, error) {
+	stream, err := c.session.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Close 客户端直接关闭底层连接，与原生QUIC一致，避免关闭会话时重置尚未读完的流；
+// 服务端只关闭会话
+func (c *WebTransportConnection) Close() error {
+	if c.conn == nil {
+		return c.session.CloseWithError(0, "")
+	}
+	err := c.conn.CloseWithError(0, "")
+	c.dialer.Close()
+	return err
+}
+
+func (c *WebTransportConnection) RemoteAddr() string {
+	return c.session.RemoteAddr().String()
+}
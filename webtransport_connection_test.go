@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// TestWebTransportEcho 客户端经WebTransport会话发送数据报，服务端回显并计入webtransport模式的会话
+func TestWebTransportEcho(t *testing.T) {
+	listener, err := quic.ListenAddr("127.0.0.1:0", generateTLSConfig(), &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	server := NewServer(ServerConfig{Mode: "native", Echo: true}, nil)
+	server.out = io.Discard
+	wt := newWebTransportServer(server, http.NewServeMux())
+	defer wt.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go wt.ServeQUICConn(conn)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialWebTransport(ctx, listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	packet := GeneratePayload(Header{Seq: 1}, 200, "random")
+	if err := conn.SendDatagram(packet); err != nil {
+		t.Fatal(err)
+	}
+	echo, err := conn.ReceiveDatagram(ctx)
+	if err != nil {
+		t.Fatalf("等待回显失败: %v", err)
+	}
+	if !bytes.Equal(echo, packet) {
+		t.Error("回显的数据报与发送的不同")
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.sessions) != 1 {
+		t.Fatalf("服务端有 %d 个会话, want 1", len(server.sessions))
+	}
+	for _, session := range server.sessions {
+		if session.Mode != "webtransport" {
+			t.Errorf("会话模式 = %q, want webtransport", session.Mode)
+		}
+	}
+}